@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"websocket-service/internal/config"
 	"websocket-service/internal/delivery/websocket/route"
 	"websocket-service/internal/utils"
@@ -16,8 +20,11 @@ func main() {
 		log.Fatalf("Could not load config: %v", err)
 	}
 
-	// Initialize Fiber app
-	app := fiber.New()
+	// Initialize Fiber app. The read buffer bounds the request headers, which caps
+	// the size of WebSocket handshakes.
+	app := fiber.New(fiber.Config{
+		ReadBufferSize: cfg.MaxHandshakeHeaderSize,
+	})
 
 	app.Use(logger.New())
 
@@ -27,8 +34,22 @@ func main() {
 	}
 	cfg.RabbitMQUtils = rmq
 	// Setup routes
-	route.SetupRoutes(app, cfg)
+	shutdown := route.SetupRoutes(app, cfg)
 
 	// Start server
-	log.Fatal(app.Listen(cfg.ServerAddress))
+	go func() {
+		if err := app.Listen(cfg.ServerAddress); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Drain connections and release backends on SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	log.Printf("Received %s, shutting down", <-signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	shutdown(ctx)
+	rmq.Close()
 }
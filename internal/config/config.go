@@ -3,6 +3,7 @@ package config
 import (
 	"google.golang.org/grpc"
 	"os"
+	"time"
 	"websocket-service/internal/utils"
 
 	"github.com/joho/godotenv"
@@ -10,14 +11,71 @@ import (
 )
 
 type Config struct {
-	ServerAddress   string `mapstructure:"SERVER_ADDRESS"`
-	GrpcServer      string `mapstructure:"GRPC_SERVER"`
-	DBDriver        string `mapstructure:"DB_DRIVER"`
-	DBSource        string `mapstructure:"DB_SOURCE"`
-	JWTSecret       string `mapstructure:"JWT_SECRET"`
-	GrpcClient      *grpc.ClientConn
-	RabbitMQUtils   *utils.RabbitMQ
-	RabbitMQAddress string `mapstructure:"RABBITMQ_ADDRESS"`
+	ServerAddress    string        `mapstructure:"SERVER_ADDRESS"`
+	GrpcServer       string        `mapstructure:"GRPC_SERVER"`
+	DBDriver         string        `mapstructure:"DB_DRIVER"`
+	DBSource         string        `mapstructure:"DB_SOURCE"`
+	JWTSecret        string        `mapstructure:"JWT_SECRET"`
+	JWTAlgorithms    []string      `mapstructure:"JWT_ALGORITHMS"`
+	JWTJWKSFile      string        `mapstructure:"JWT_JWKS_FILE"`
+	JWTIssuer        string        `mapstructure:"JWT_ISSUER"`
+	JWTAudience      string        `mapstructure:"JWT_AUDIENCE"`
+	JWTLeeway        time.Duration `mapstructure:"JWT_LEEWAY"`
+	JWTModeratorRole string        `mapstructure:"JWT_MODERATOR_ROLE"`
+	JWTAdminRole     string        `mapstructure:"JWT_ADMIN_ROLE"`
+	GrpcClient       *grpc.ClientConn
+	RabbitMQUtils    *utils.RabbitMQ
+	RabbitMQAddress  string `mapstructure:"RABBITMQ_ADDRESS"`
+
+	// ConversationCacheTTL bounds how long participant lists fetched over gRPC
+	// are trusted.
+	ConversationCacheTTL time.Duration `mapstructure:"GRPC_CONVERSATION_CACHE_TTL"`
+	// MaxTrackedMessages bounds how many messages the state the chat backend
+	// cannot store yet, such as receipts, is kept in memory for.
+	MaxTrackedMessages int `mapstructure:"GRPC_MAX_TRACKED_MESSAGES"`
+
+	TokenExpiryWarning time.Duration `mapstructure:"WS_TOKEN_EXPIRY_WARNING"`
+	TicketTTL          time.Duration `mapstructure:"WS_TICKET_TTL"`
+	TicketBindIP       bool          `mapstructure:"WS_TICKET_BIND_IP"`
+
+	AllowedOrigins         []string      `mapstructure:"WS_ALLOWED_ORIGINS"`
+	Subprotocols           []string      `mapstructure:"WS_SUBPROTOCOLS"`
+	RequireSubprotocol     bool          `mapstructure:"WS_REQUIRE_SUBPROTOCOL"`
+	HandshakeTimeout       time.Duration `mapstructure:"WS_HANDSHAKE_TIMEOUT"`
+	MaxHandshakeHeaderSize int           `mapstructure:"WS_MAX_HANDSHAKE_HEADER_SIZE"`
+
+	Compression          bool `mapstructure:"WS_COMPRESSION"`
+	CompressionLevel     int  `mapstructure:"WS_COMPRESSION_LEVEL"`
+	CompressionThreshold int  `mapstructure:"WS_COMPRESSION_THRESHOLD"`
+
+	PingInterval time.Duration `mapstructure:"WS_PING_INTERVAL"`
+	PongWait     time.Duration `mapstructure:"WS_PONG_WAIT"`
+	WriteTimeout time.Duration `mapstructure:"WS_WRITE_TIMEOUT"`
+
+	SendQueueSize      int    `mapstructure:"WS_SEND_QUEUE_SIZE"`
+	SlowConsumerPolicy string `mapstructure:"WS_SLOW_CONSUMER_POLICY"`
+
+	MaxConnectionsPerUser int    `mapstructure:"WS_MAX_CONNECTIONS_PER_USER"`
+	MaxConnections        int    `mapstructure:"WS_MAX_CONNECTIONS"`
+	ConnectionLimitPolicy string `mapstructure:"WS_CONNECTION_LIMIT_POLICY"`
+
+	ReadLimit         int64 `mapstructure:"WS_READ_LIMIT"`
+	MaxMessageLength  int   `mapstructure:"WS_MAX_MESSAGE_LENGTH"`
+	MaxInflightFrames int   `mapstructure:"WS_MAX_INFLIGHT_FRAMES"`
+
+	TypingDebounce time.Duration `mapstructure:"WS_TYPING_DEBOUNCE"`
+	TypingTimeout  time.Duration `mapstructure:"WS_TYPING_TIMEOUT"`
+
+	ThreadScopedFanout bool `mapstructure:"WS_THREAD_SCOPED_FANOUT"`
+
+	UserRateLimit         float64 `mapstructure:"WS_USER_RATE_LIMIT"`
+	UserRateBurst         int     `mapstructure:"WS_USER_RATE_BURST"`
+	ConversationRateLimit float64 `mapstructure:"WS_CONVERSATION_RATE_LIMIT"`
+	ConversationRateBurst int     `mapstructure:"WS_CONVERSATION_RATE_BURST"`
+
+	ShutdownTimeout      time.Duration `mapstructure:"WS_SHUTDOWN_TIMEOUT"`
+	ShutdownCloseTimeout time.Duration `mapstructure:"WS_SHUTDOWN_CLOSE_TIMEOUT"`
+	ReconnectAfter       time.Duration `mapstructure:"WS_RECONNECT_AFTER"`
 }
 
 func LoadConfig() (Config, error) {
@@ -29,6 +87,45 @@ func LoadConfig() (Config, error) {
 
 	viper.AutomaticEnv()
 
+	viper.SetDefault("GRPC_CONVERSATION_CACHE_TTL", "30s")
+	viper.SetDefault("GRPC_MAX_TRACKED_MESSAGES", 100000)
+	viper.SetDefault("JWT_ALGORITHMS", "HS256")
+	viper.SetDefault("JWT_LEEWAY", "0s")
+	viper.SetDefault("JWT_MODERATOR_ROLE", "moderator")
+	viper.SetDefault("JWT_ADMIN_ROLE", "admin")
+	viper.SetDefault("WS_TOKEN_EXPIRY_WARNING", "1m")
+	viper.SetDefault("WS_TICKET_TTL", "30s")
+	viper.SetDefault("WS_TICKET_BIND_IP", false)
+	viper.SetDefault("WS_ALLOWED_ORIGINS", "")
+	viper.SetDefault("WS_SUBPROTOCOLS", "chat.v1.msgpack,chat.v1.proto,chat.v1.json,chat.v1")
+	viper.SetDefault("WS_REQUIRE_SUBPROTOCOL", false)
+	viper.SetDefault("WS_HANDSHAKE_TIMEOUT", "10s")
+	viper.SetDefault("WS_MAX_HANDSHAKE_HEADER_SIZE", 8192)
+	viper.SetDefault("WS_COMPRESSION", true)
+	viper.SetDefault("WS_COMPRESSION_LEVEL", 1)
+	viper.SetDefault("WS_COMPRESSION_THRESHOLD", 512)
+	viper.SetDefault("WS_PING_INTERVAL", "30s")
+	viper.SetDefault("WS_PONG_WAIT", "60s")
+	viper.SetDefault("WS_WRITE_TIMEOUT", "10s")
+	viper.SetDefault("WS_SEND_QUEUE_SIZE", 256)
+	viper.SetDefault("WS_SLOW_CONSUMER_POLICY", "disconnect")
+	viper.SetDefault("WS_MAX_CONNECTIONS_PER_USER", 10)
+	viper.SetDefault("WS_MAX_CONNECTIONS", 0)
+	viper.SetDefault("WS_CONNECTION_LIMIT_POLICY", "evict_oldest")
+	viper.SetDefault("WS_READ_LIMIT", 65536)
+	viper.SetDefault("WS_MAX_MESSAGE_LENGTH", 4096)
+	viper.SetDefault("WS_MAX_INFLIGHT_FRAMES", 16)
+	viper.SetDefault("WS_TYPING_DEBOUNCE", "2s")
+	viper.SetDefault("WS_TYPING_TIMEOUT", "6s")
+	viper.SetDefault("WS_THREAD_SCOPED_FANOUT", false)
+	viper.SetDefault("WS_USER_RATE_LIMIT", 5)
+	viper.SetDefault("WS_USER_RATE_BURST", 20)
+	viper.SetDefault("WS_CONVERSATION_RATE_LIMIT", 20)
+	viper.SetDefault("WS_CONVERSATION_RATE_BURST", 50)
+	viper.SetDefault("WS_SHUTDOWN_TIMEOUT", "10s")
+	viper.SetDefault("WS_SHUTDOWN_CLOSE_TIMEOUT", "3s")
+	viper.SetDefault("WS_RECONNECT_AFTER", "5s")
+
 	err := viper.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -41,6 +138,9 @@ func LoadConfig() (Config, error) {
 		viper.SetDefault("DB_DRIVER", os.Getenv("DB_DRIVER"))
 		viper.SetDefault("DB_SOURCE", os.Getenv("DB_SOURCE"))
 		viper.SetDefault("JWT_SECRET", os.Getenv("JWT_SECRET"))
+		viper.SetDefault("JWT_JWKS_FILE", os.Getenv("JWT_JWKS_FILE"))
+		viper.SetDefault("JWT_ISSUER", os.Getenv("JWT_ISSUER"))
+		viper.SetDefault("JWT_AUDIENCE", os.Getenv("JWT_AUDIENCE"))
 		viper.SetDefault("GRPC_SERVER", os.Getenv("GRPC_SERVER"))
 		viper.SetDefault("RABBITMQ_ADDRESS", os.Getenv("RABBITMQ_ADDRESS"))
 	}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/expvarhandler"
+)
+
+// AdminController lets administrators inspect and close live connections.
+type AdminController struct {
+	manager *utils.WebSocketManager
+}
+
+func NewAdminController(manager *utils.WebSocketManager) *AdminController {
+	return &AdminController{
+		manager: manager,
+	}
+}
+
+func (controller *AdminController) Sessions(c *fiber.Ctx) error {
+	return c.JSON(model.Response("success", "Connected users", controller.manager.Sessions()))
+}
+
+// Vars serves the expvar metrics, memory and compression stats among them.
+func (controller *AdminController) Vars(c *fiber.Ctx) error {
+	expvarhandler.ExpvarHandler(c.Context())
+	return nil
+}
+
+func (controller *AdminController) UserSessions(c *fiber.Ctx) error {
+	userId, err := userIdParam(c)
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, err)
+	}
+
+	sessions := controller.manager.UserSessions(userId)
+	if len(sessions) == 0 {
+		return e.HandleHttpErrorFiber(c, e.NotFound("User is not connected"))
+	}
+	return c.JSON(model.Response("success", "User sessions", model.UserSessionsResponse{
+		UserId:   int(userId),
+		Sessions: sessions,
+	}))
+}
+
+func (controller *AdminController) DisconnectUser(c *fiber.Ctx) error {
+	userId, err := userIdParam(c)
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, err)
+	}
+	request, err := disconnectRequest(c)
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, err)
+	}
+
+	disconnected := controller.manager.DisconnectUser(userId, request.Reason)
+	if disconnected == 0 {
+		return e.HandleHttpErrorFiber(c, e.NotFound("User is not connected"))
+	}
+	return c.JSON(model.Response("success", "User disconnected", model.DisconnectResponse{Disconnected: disconnected}))
+}
+
+func (controller *AdminController) DisconnectSession(c *fiber.Ctx) error {
+	sessionId, err := strconv.ParseUint(c.Params("sessionId"), 10, 64)
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, e.Validation(errors.New("invalid session id")))
+	}
+	request, err := disconnectRequest(c)
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, err)
+	}
+
+	if !controller.manager.DisconnectSession(sessionId, request.Reason) {
+		return e.HandleHttpErrorFiber(c, e.NotFound("Session not found"))
+	}
+	return c.JSON(model.Response("success", "Session disconnected", model.DisconnectResponse{Disconnected: 1}))
+}
+
+func (controller *AdminController) Queues(c *fiber.Ctx) error {
+	return c.JSON(model.Response("success", "Send queues", controller.manager.QueueStats()))
+}
+
+func userIdParam(c *fiber.Ctx) (uint32, error) {
+	userId, err := strconv.ParseUint(c.Params("userId"), 10, 32)
+	if err != nil {
+		return 0, e.Validation(errors.New("invalid user id"))
+	}
+	return uint32(userId), nil
+}
+
+// disconnectRequest reads the optional reason, a missing body meaning none.
+func disconnectRequest(c *fiber.Ctx) (model.DisconnectRequest, error) {
+	var request model.DisconnectRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return request, e.Validation(err)
+		}
+	}
+	if err := utils.Validate(request); err != nil {
+		return request, e.Validation(err)
+	}
+	if len(request.Reason) > utils.MaxCloseReasonLength {
+		return request, e.Validation(fmt.Errorf("reason is longer than %d bytes", utils.MaxCloseReasonLength))
+	}
+	return request, nil
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	LocalClaims = "claims"
+	LocalUserId = "userId"
+	LocalToken  = "token"
+)
+
+// Authenticated requires a valid "Authorization: Bearer <token>" header and makes
+// the claims, user id and raw token available through c.Locals.
+func Authenticated(verifier *utils.TokenVerifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return e.HandleHttpErrorFiber(c, e.Unauthorized(errors.New("missing bearer token")))
+		}
+
+		token = strings.TrimSpace(token)
+		claims, err := verifier.Parse(token)
+		if err != nil {
+			return e.HandleHttpErrorFiber(c, e.Unauthorized(errors.New("invalid token")))
+		}
+
+		userId, err := strconv.Atoi(claims.UserID)
+		if err != nil {
+			return e.HandleHttpErrorFiber(c, e.Unauthorized(errors.New("invalid user in token")))
+		}
+
+		c.Locals(LocalClaims, claims)
+		c.Locals(LocalUserId, userId)
+		c.Locals(LocalToken, token)
+		return c.Next()
+	}
+}
+
+// RequireRole lets through only requests whose token, checked by Authenticated
+// beforehand, carries the role in its roles claim.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals(LocalClaims).(*utils.Claims)
+		if !ok || role == "" || !claims.Roles.Contains(role) {
+			return e.HandleHttpErrorFiber(c, e.Forbidden("insufficient role"))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TicketController struct {
+	ticketService service.TicketService
+}
+
+func NewTicketController(ticketService service.TicketService) *TicketController {
+	return &TicketController{
+		ticketService: ticketService,
+	}
+}
+
+// Issue exchanges the caller's bearer token for a one-time ticket, for clients
+// that cannot set headers on the WebSocket upgrade.
+func (controller *TicketController) Issue(c *fiber.Ctx) error {
+	userId := c.Locals(LocalUserId).(int)
+	token := c.Locals(LocalToken).(string)
+
+	ticket, err := controller.ticketService.Issue(userId, token, c.IP())
+	if err != nil {
+		return e.HandleHttpErrorFiber(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(model.Response("success", "Ticket issued", ticket))
+}
@@ -8,6 +8,11 @@ import (
 	"websocket-service/internal/utils"
 )
 
+const (
+	consumerNotification = "consumer1"
+	consumerBroadcast    = "consumer2"
+)
+
 type RabbitMQConsumer struct {
 	chatService   *service.ChatService
 	manager       *utils.WebSocketManager
@@ -26,20 +31,33 @@ func (r *RabbitMQConsumer) Run() {
 	go r.StartConsumeBroadcast()
 }
 
+// Stop cancels both consumers so no more notifications are taken off the queues.
+func (r *RabbitMQConsumer) Stop() {
+	for _, consumer := range []string{consumerNotification, consumerBroadcast} {
+		if err := r.rabbitMQUtils.Cancel(consumer); err != nil {
+			log.Printf("Failed to cancel consumer %s: %v", consumer, err)
+		}
+	}
+}
+
 func (r *RabbitMQConsumer) StartConsumeNotification() {
 	err := r.rabbitMQUtils.DeclareQueue(utils.QUEUE_NOTIFICATION)
 	if err != nil {
 		log.Fatalf("Failed to declare queue2: %v", err)
 	}
 
-	err = r.rabbitMQUtils.ConsumeMessages(utils.QUEUE_NOTIFICATION, "consumer1", func(body string) {
+	err = r.rabbitMQUtils.ConsumeMessages(utils.QUEUE_NOTIFICATION, consumerNotification, func(body string) {
 		var notification entity.Notification
 		err = json.Unmarshal([]byte(body), &notification)
 		if err != nil {
 			log.Fatalf("Failed to unmarshal notification: %v", err)
 		}
 
-		r.manager.JobMessageNotification([]uint32{uint32(notification.UserID)}, notification.Message)
+		if notification.DeviceID != "" {
+			r.manager.JobDeviceNotification(uint32(notification.UserID), notification.DeviceID, notification.Message)
+			return
+		}
+		r.manager.JobMessageNotification([]uint32{uint32(notification.UserID)}, notification.Message, nil)
 
 	})
 	if err != nil {
@@ -54,7 +72,7 @@ func (r *RabbitMQConsumer) StartConsumeBroadcast() {
 		log.Fatalf("Failed to declare queue2: %v", err)
 	}
 
-	err = r.rabbitMQUtils.ConsumeMessages(utils.QUEUE_BROADCAST, "consumer2", func(body string) {
+	err = r.rabbitMQUtils.ConsumeMessages(utils.QUEUE_BROADCAST, consumerBroadcast, func(body string) {
 		var notification entity.Notification
 		err = json.Unmarshal([]byte(body), &notification)
 		if err != nil {
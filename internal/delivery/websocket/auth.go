@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"strconv"
+	"strings"
+	"websocket-service/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	localClaims         = "claims"
+	localUserId         = "userId"
+	localDeviceId       = "deviceId"
+	localHandshakeError = "handshakeError"
+
+	BearerSubprotocol = "bearer"
+)
+
+// handshakeError is stashed on the upgrade request when authentication fails,
+// so Connect can close the socket with a meaningful code instead of a bare 426.
+type handshakeError struct {
+	Code   int
+	Reason string
+}
+
+func (err *handshakeError) Error() string {
+	return err.Reason
+}
+
+func (controller *WebSocketController) authenticate(c *fiber.Ctx) (*utils.Claims, int, *handshakeError) {
+	tokenStr := tokenFromRequest(c)
+	if ticket := c.Query("ticket"); ticket != "" {
+		token, err := controller.ticketService.Redeem(ticket, c.IP())
+		if err != nil {
+			return nil, 0, &handshakeError{Code: utils.CloseUnauthorized, Reason: "invalid ticket"}
+		}
+		tokenStr = token
+	}
+
+	if tokenStr == "" {
+		return nil, 0, &handshakeError{Code: utils.CloseUnauthorized, Reason: "missing token"}
+	}
+
+	claims, err := controller.parseToken(tokenStr)
+	if err != nil {
+		return nil, 0, &handshakeError{Code: utils.CloseUnauthorized, Reason: "invalid token"}
+	}
+
+	userId, err := strconv.Atoi(claims.UserID)
+	if err != nil {
+		return nil, 0, &handshakeError{Code: utils.CloseUnauthorized, Reason: "invalid user in token"}
+	}
+
+	if userIdStr := c.Params("userId"); userIdStr != "" && userIdStr != claims.UserID {
+		return nil, 0, &handshakeError{Code: utils.CloseForbidden, Reason: "token does not match user"}
+	}
+
+	return claims, userId, nil
+}
+
+// tokenFromRequest looks for a bearer token in the Authorization header, then in
+// Sec-WebSocket-Protocol as "bearer, <token>", then in the token query param.
+// Tickets issued by TicketController are handled separately in authenticate.
+func tokenFromRequest(c *fiber.Ctx) string {
+	if auth := c.Get(fiber.HeaderAuthorization); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	protocols := strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",")
+	for i := 0; i < len(protocols)-1; i++ {
+		if strings.EqualFold(strings.TrimSpace(protocols[i]), BearerSubprotocol) {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+
+	return c.Query("token")
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/utils"
+)
+
+func (controller *WebSocketController) handleChatSend(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.MessageRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	message, userIds, err := controller.chatService.ProcessMessage(connInfo.UserId, request)
+	if err != nil {
+		return model.AckPayload{}, err
+	}
+
+	// The sender's other devices get the message like everyone else. Legacy
+	// clients have no ack, so the echo is all they get.
+	origin := connInfo
+	if request.IncludeOrigin || connInfo.Codec == model.LegacyCodec {
+		origin = nil
+	}
+
+	controller.typingService.StopTyping(connInfo.UserId, request.ConversationId)
+	controller.manager.JobMessageChat(userIds, message, origin)
+	controller.manager.JobMessageNotification(userIds, request.Message, origin)
+	return model.AckPayload{
+		MessageId: message.ID,
+		Timestamp: message.CreatedAt,
+	}, nil
+}
+
+// handleThreadGet sends the replies of a thread back to the requesting
+// connection as chat messages, ahead of the ack.
+func (controller *WebSocketController) handleThreadGet(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.ThreadRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	replies, err := controller.chatService.GetThread(connInfo.UserId, request)
+	if err != nil {
+		return model.AckPayload{}, err
+	}
+
+	for _, reply := range replies {
+		controller.manager.SendToConn(connInfo, model.FrameResponse{
+			Type:      model.FrameTypeChatMessage,
+			RequestId: frame.RequestId,
+			Payload:   utils.NewChatMessagePayload(reply),
+		})
+	}
+	return model.AckPayload{MessageId: request.ParentId}, nil
+}
+
+func (controller *WebSocketController) handleTypingStart(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.TypingRequest
+	if err := bindAndValidate(frame, &request); err != nil {
+		return model.AckPayload{}, err
+	}
+
+	return model.AckPayload{}, controller.typingService.StartTyping(connInfo.UserId, request.ConversationId)
+}
+
+func (controller *WebSocketController) handleTypingStop(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.TypingRequest
+	if err := bindAndValidate(frame, &request); err != nil {
+		return model.AckPayload{}, err
+	}
+
+	controller.typingService.StopTyping(connInfo.UserId, request.ConversationId)
+	return model.AckPayload{}, nil
+}
+
+func (controller *WebSocketController) handleReceiptDelivered(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	return controller.handleReceipt(connInfo, frame, entity.ReceiptStatusDelivered)
+}
+
+func (controller *WebSocketController) handleReceiptRead(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	return controller.handleReceipt(connInfo, frame, entity.ReceiptStatusRead)
+}
+
+func (controller *WebSocketController) handleReceipt(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest, status string) (model.AckPayload, error) {
+	var request model.ReceiptRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	return model.AckPayload{}, controller.receiptService.MarkMessages(connInfo.UserId, request, status)
+}
+
+// handleMessageEdit lets the author or a moderator change a message, and tells
+// the conversation about it.
+func (controller *WebSocketController) handleMessageEdit(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.EditMessageRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	message, userIds, err := controller.messageService.EditMessage(connInfo.UserId, connInfo.Claims.Roles, request)
+	if err != nil {
+		return model.AckPayload{}, err
+	}
+
+	controller.manager.JobMessageUpdated(userIds, message, connInfo.UserId)
+	return model.AckPayload{
+		MessageId: message.ID,
+		Timestamp: message.EditedAt,
+	}, nil
+}
+
+func (controller *WebSocketController) handleMessageDelete(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.DeleteMessageRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	message, userIds, err := controller.messageService.DeleteMessage(connInfo.UserId, connInfo.Claims.Roles, request)
+	if err != nil {
+		return model.AckPayload{}, err
+	}
+
+	controller.manager.JobMessageDeleted(userIds, message, connInfo.UserId)
+	return model.AckPayload{
+		MessageId: message.ID,
+		Timestamp: message.DeletedAt,
+	}, nil
+}
+
+func (controller *WebSocketController) handleReactionAdd(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.ReactionRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	return model.AckPayload{MessageId: request.MessageId}, controller.reactionService.AddReaction(connInfo.UserId, request)
+}
+
+func (controller *WebSocketController) handleReactionRemove(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.ReactionRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	return model.AckPayload{MessageId: request.MessageId}, controller.reactionService.RemoveReaction(connInfo.UserId, request)
+}
+
+// handleReactionList sends the current totals of each requested message back
+// to the requesting connection, ahead of the ack.
+func (controller *WebSocketController) handleReactionList(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.ReactionListRequest
+	if err := frame.Bind(&request); err != nil {
+		return model.AckPayload{}, e.Validation(err)
+	}
+
+	reactions, err := controller.reactionService.ListReactions(connInfo.UserId, request)
+	if err != nil {
+		return model.AckPayload{}, err
+	}
+
+	for _, reaction := range reactions {
+		controller.manager.SendToConn(connInfo, model.FrameResponse{
+			Type:      model.FrameTypeReaction,
+			RequestId: frame.RequestId,
+			Payload:   reaction,
+		})
+	}
+	return model.AckPayload{}, nil
+}
+
+// handleReauth swaps the claims of a live connection for those of a fresh token,
+// which must belong to the user the connection was opened for.
+func (controller *WebSocketController) handleReauth(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	var request model.ReauthRequest
+	if err := bindAndValidate(frame, &request); err != nil {
+		return model.AckPayload{}, err
+	}
+
+	claims, err := controller.parseToken(request.Token)
+	if err != nil {
+		return model.AckPayload{}, e.Unauthorized(errors.New("invalid token"))
+	}
+
+	if claims.UserID != strconv.Itoa(connInfo.UserId) {
+		log.Printf("Reauth for user %d presented a token for user %s", connInfo.UserId, claims.UserID)
+		controller.manager.CloseConn(connInfo, utils.CloseForbidden, "token does not match user")
+		return model.AckPayload{}, e.Forbidden("token does not match user")
+	}
+
+	controller.manager.RenewToken(connInfo, claims)
+	return model.AckPayload{
+		ExpiresAt: utils.TokenExpiry(claims),
+	}, nil
+}
+
+func bindAndValidate(frame model.FrameRequest, request interface{}) error {
+	if err := frame.Bind(request); err != nil {
+		return e.Validation(err)
+	}
+	return utils.Validate(request)
+}
@@ -0,0 +1,35 @@
+package websocket
+
+import (
+	"fmt"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/utils"
+)
+
+// FrameHandler handles one inbound frame. The returned payload is sent back as
+// the frame's ack; an error is sent back as an error frame instead.
+type FrameHandler func(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error)
+
+// FrameRouter dispatches inbound frames to the handler registered for their type.
+type FrameRouter struct {
+	handlers map[string]FrameHandler
+}
+
+func NewFrameRouter() *FrameRouter {
+	return &FrameRouter{
+		handlers: make(map[string]FrameHandler),
+	}
+}
+
+func (router *FrameRouter) Handle(frameType string, handler FrameHandler) {
+	router.handlers[frameType] = handler
+}
+
+func (router *FrameRouter) Dispatch(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) (model.AckPayload, error) {
+	handler, ok := router.handlers[frame.Type]
+	if !ok {
+		return model.AckPayload{}, e.Validation(fmt.Errorf("unknown frame type %q", frame.Type))
+	}
+	return handler(connInfo, frame)
+}
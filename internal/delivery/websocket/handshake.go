@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	e "websocket-service/internal/exception"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+const supportedWebSocketVersion = "13"
+
+const HeaderDeviceId = "X-Device-Id"
+
+var deviceIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type HandshakeConfig struct {
+	// AllowedOrigins lists the accepted Origin values. "*" allows any origin and
+	// patterns such as "https://*.example.com" allow any subdomain. Left empty,
+	// every browser is refused.
+	AllowedOrigins []string
+	// Subprotocols are the application subprotocols the server speaks, in order
+	// of preference.
+	Subprotocols []string
+	// RequireSubprotocol rejects clients that offer none of Subprotocols.
+	RequireSubprotocol bool
+}
+
+// Handshake validates the upgrade request before any authentication happens, so
+// cross-site pages cannot open sockets riding on the user's credentials.
+func Handshake(config HandshakeConfig) fiber.Handler {
+	origins := make([]string, 0, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		if origin = strings.ToLower(strings.TrimSpace(origin)); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		if c.Get(fiber.HeaderSecWebSocketVersion) != supportedWebSocketVersion {
+			c.Set(fiber.HeaderSecWebSocketVersion, supportedWebSocketVersion)
+			return e.HandleHttpErrorFiber(c, e.Err{
+				ErrorType: e.TypeErrorValidation,
+				ErrorCode: fiber.StatusUpgradeRequired,
+				Message:   "unsupported websocket version",
+			})
+		}
+
+		// Browsers always send Origin; clients without one are not subject to CSWSH.
+		if origin := c.Get(fiber.HeaderOrigin); origin != "" && !originAllowed(origins, strings.ToLower(origin)) {
+			return e.HandleHttpErrorFiber(c, e.Forbidden("origin not allowed"))
+		}
+
+		if config.RequireSubprotocol && !offersSubprotocol(c, config.Subprotocols) {
+			return e.HandleHttpErrorFiber(c, e.Validation(errors.New("unsupported subprotocol, expected one of: "+strings.Join(config.Subprotocols, ", "))))
+		}
+
+		deviceId := deviceIdFromRequest(c)
+		if deviceId != "" && !deviceIdPattern.MatchString(deviceId) {
+			return e.HandleHttpErrorFiber(c, e.Validation(errors.New("invalid device id, expected up to 64 letters, digits, '.', '_', ':' or '-'")))
+		}
+		c.Locals(localDeviceId, deviceId)
+
+		return c.Next()
+	}
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if matched, _ := path.Match(pattern, origin); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func offersSubprotocol(c *fiber.Ctx, supported []string) bool {
+	for _, offered := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		offered = strings.TrimSpace(offered)
+		for _, protocol := range supported {
+			if offered == protocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deviceIdFromRequest reads the device the client connects from, declared in the
+// X-Device-Id header or, for browsers, the device_id query param.
+func deviceIdFromRequest(c *fiber.Ctx) string {
+	if deviceId := c.Get(HeaderDeviceId); deviceId != "" {
+		return deviceId
+	}
+	return c.Query("device_id")
+}
@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"nothing allowed", nil, "https://chat.example.com", false},
+		{"any origin", []string{"*"}, "https://evil.example.net", true},
+		{"exact match", []string{"https://chat.example.com"}, "https://chat.example.com", true},
+		{"other scheme", []string{"https://chat.example.com"}, "http://chat.example.com", false},
+		{"other port", []string{"https://chat.example.com"}, "https://chat.example.com:8443", false},
+		{"suffix is not enough", []string{"https://example.com"}, "https://evil-example.com", false},
+		{"subdomain wildcard", []string{"https://*.example.com"}, "https://chat.example.com", true},
+		{"subdomain wildcard excludes apex", []string{"https://*.example.com"}, "https://example.com", false},
+		{"subdomain wildcard excludes other domains", []string{"https://*.example.com"}, "https://example.com.evil.net", false},
+		{"port wildcard", []string{"http://localhost:*"}, "http://localhost:3000", true},
+		{"second entry", []string{"https://a.example.com", "https://b.example.com"}, "https://b.example.com", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := originAllowed(test.allowed, test.origin); got != test.want {
+				t.Fatalf("originAllowed(%q, %q) = %v, want %v", test.allowed, test.origin, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandshakeChecksOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		status  int
+	}{
+		{"empty allow-list refuses browsers", nil, "https://chat.example.com", fiber.StatusForbidden},
+		{"blank entries allow nothing", []string{" ", ""}, "https://chat.example.com", fiber.StatusForbidden},
+		{"wildcard", []string{"*"}, "https://chat.example.com", fiber.StatusOK},
+		{"exact match", []string{"https://chat.example.com"}, "https://chat.example.com", fiber.StatusOK},
+		{"case insensitive", []string{" HTTPS://Chat.Example.com "}, "https://chat.example.COM", fiber.StatusOK},
+		{"cross-site", []string{"https://chat.example.com"}, "https://evil.example.net", fiber.StatusForbidden},
+		// Only browsers send Origin, and only they can be tricked into a
+		// cross-site handshake.
+		{"missing header", nil, "", fiber.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/ws", Handshake(HandshakeConfig{AllowedOrigins: test.allowed}), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/ws", nil)
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Sec-WebSocket-Version", supportedWebSocketVersion)
+			req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+}
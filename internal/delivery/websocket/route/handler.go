@@ -1,8 +1,11 @@
 package route
 
 import (
+	"context"
+	"expvar"
 	"log"
 	"websocket-service/internal/config"
+	httpdelivery "websocket-service/internal/delivery/http"
 	rabbitmqdelivery "websocket-service/internal/delivery/rabbitmq"
 	wsdelivery "websocket-service/internal/delivery/websocket"
 	"websocket-service/internal/service"
@@ -12,31 +15,150 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/klauspost/compress/flate"
 	grpcrepository "websocket-service/internal/repository/grpc"
+	memoryrepository "websocket-service/internal/repository/memory"
 )
 
-func SetupRoutes(app *fiber.App, cfg config.Config) {
+// SetupRoutes wires the service and returns the function shutting it down.
+func SetupRoutes(app *fiber.App, cfg config.Config) func(ctx context.Context) {
 
 	conn, err := grpc.Dial(cfg.GrpcServer, grpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("Failed to connect to gRPC server: %v", err)
 	}
-	//defer conn.Close()
 
 	cfg.GrpcClient = conn
 
-	manager := utils.NewWebSocketManager()
+	if cfg.CompressionLevel < flate.HuffmanOnly || cfg.CompressionLevel > flate.BestCompression {
+		log.Fatalf("Invalid compression level %d", cfg.CompressionLevel)
+	}
+	if cfg.SendQueueSize < 1 {
+		log.Fatalf("Invalid send queue size %d", cfg.SendQueueSize)
+	}
+	slowConsumerPolicy, err := utils.ParseSlowConsumerPolicy(cfg.SlowConsumerPolicy)
+	if err != nil {
+		log.Fatalf("Invalid slow consumer policy: %v", err)
+	}
+	// Pongs answer pings, so waiting no longer than a ping interval for one
+	// drops every idle client. Zero intervals disable pings and the wait.
+	if cfg.PingInterval > 0 && cfg.PongWait > 0 && cfg.PongWait <= cfg.PingInterval {
+		log.Fatalf("Pong wait %s must be longer than the ping interval %s", cfg.PongWait, cfg.PingInterval)
+	}
+	if cfg.MaxConnectionsPerUser < 0 || cfg.MaxConnections < 0 {
+		log.Fatalf("Invalid connection limits %d per user, %d in total", cfg.MaxConnectionsPerUser, cfg.MaxConnections)
+	}
+	if cfg.ReadLimit < 0 || cfg.MaxMessageLength < 0 || cfg.MaxInflightFrames < 0 {
+		log.Fatalf("Invalid inbound limits: read limit %d, message length %d, %d frames in flight", cfg.ReadLimit, cfg.MaxMessageLength, cfg.MaxInflightFrames)
+	}
+	connectionLimitPolicy, err := utils.ParseConnectionLimitPolicy(cfg.ConnectionLimitPolicy)
+	if err != nil {
+		log.Fatalf("Invalid connection limit policy: %v", err)
+	}
+
+	manager := utils.NewWebSocketManager(utils.WebSocketManagerConfig{
+		TokenExpiryWarning:   cfg.TokenExpiryWarning,
+		Compression:          cfg.Compression,
+		CompressionLevel:     cfg.CompressionLevel,
+		CompressionThreshold: cfg.CompressionThreshold,
+		PingInterval:         cfg.PingInterval,
+		PongWait:             cfg.PongWait,
+		WriteTimeout:         cfg.WriteTimeout,
+		SendQueueSize:        cfg.SendQueueSize,
+		SlowConsumerPolicy:   slowConsumerPolicy,
+		ReconnectAfter:       cfg.ReconnectAfter,
+		ReadLimit:            cfg.ReadLimit,
+		MaxInflightFrames:    cfg.MaxInflightFrames,
+		Limits: utils.ConnectionLimits{
+			PerUser: cfg.MaxConnectionsPerUser,
+			Total:   cfg.MaxConnections,
+			Policy:  connectionLimitPolicy,
+		},
+	})
+	expvar.Publish("websocket_compression", expvar.Func(func() any {
+		return manager.CompressionStats()
+	}))
 	amqpDelivery := rabbitmqdelivery.NewRabbitMQConsumer(manager, cfg.RabbitMQUtils)
 
 	go manager.Run()
 	amqpDelivery.Run()
 
-	chatRepository := grpcrepository.NewChatRepository(cfg.GrpcClient)
-	chatService := service.NewChatService(chatRepository)
+	chatRepository := grpcrepository.NewChatRepository(cfg.GrpcClient, cfg.ConversationCacheTTL, cfg.MaxTrackedMessages)
+	userLimiter := utils.NewRateLimiter(cfg.UserRateLimit, cfg.UserRateBurst)
+	conversationLimiter := utils.NewRateLimiter(cfg.ConversationRateLimit, cfg.ConversationRateBurst)
+	chatService := service.NewChatService(chatRepository, cfg.ThreadScopedFanout, userLimiter, conversationLimiter, cfg.MaxMessageLength)
+	typingService := service.NewTypingService(chatRepository, manager.JobTyping, cfg.TypingDebounce, cfg.TypingTimeout)
+	receiptService := service.NewReceiptService(chatRepository, manager.JobReceipt)
+	messageService := service.NewMessageService(chatRepository, cfg.JWTModeratorRole, cfg.MaxMessageLength)
+	reactionService := service.NewReactionService(chatRepository, manager.JobReaction)
 
-	websocketController := wsdelivery.NewWebSocketController(manager, chatService)
+	verifier, err := utils.NewTokenVerifier(utils.TokenVerifierConfig{
+		Algorithms: cfg.JWTAlgorithms,
+		Secret:     cfg.JWTSecret,
+		JWKSFile:   cfg.JWTJWKSFile,
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		Leeway:     cfg.JWTLeeway,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up JWT verification: %v", err)
+	}
+
+	ticketRepository := memoryrepository.NewTicketRepository()
+	ticketService := service.NewTicketService(ticketRepository, cfg.TicketTTL, cfg.TicketBindIP)
+
+	websocketController := wsdelivery.NewWebSocketController(manager, chatService, ticketService, typingService, receiptService, messageService, reactionService, verifier)
+	ticketController := httpdelivery.NewTicketController(ticketService)
+	adminController := httpdelivery.NewAdminController(manager)
+
+	app.Post("/ws/ticket", httpdelivery.Authenticated(verifier), ticketController.Issue)
 
-	app.Use("/ws/:userId", websocket.New(websocketController.Connect))
+	admin := app.Group("/admin", httpdelivery.Authenticated(verifier), httpdelivery.RequireRole(cfg.JWTAdminRole))
+	admin.Get("/sessions", adminController.Sessions)
+	admin.Post("/sessions/:sessionId/disconnect", adminController.DisconnectSession)
+	admin.Get("/users/:userId/sessions", adminController.UserSessions)
+	admin.Post("/users/:userId/disconnect", adminController.DisconnectUser)
+	admin.Get("/queues", adminController.Queues)
+	admin.Get("/debug/vars", adminController.Vars)
 
-	app.Get("/ws/:userId", websocketController.Get)
+	if len(cfg.AllowedOrigins) == 0 {
+		log.Println("WS_ALLOWED_ORIGINS is empty, browsers will not be able to connect")
+	}
+	handshake := wsdelivery.Handshake(wsdelivery.HandshakeConfig{
+		AllowedOrigins:     cfg.AllowedOrigins,
+		Subprotocols:       cfg.Subprotocols,
+		RequireSubprotocol: cfg.RequireSubprotocol,
+	})
+	upgrade := websocket.New(websocketController.Connect, websocket.Config{
+		HandshakeTimeout:  cfg.HandshakeTimeout,
+		Subprotocols:      append(append([]string{}, cfg.Subprotocols...), wsdelivery.BearerSubprotocol),
+		EnableCompression: cfg.Compression,
+	})
+
+	app.Get("/ws", handshake, websocketController.Get, upgrade)
+	app.Get("/ws/:userId", handshake, websocketController.Get, upgrade)
+
+	return func(ctx context.Context) {
+		amqpDelivery.Stop()
+		if err := manager.Shutdown(ctx); err != nil {
+			log.Printf("Failed to drain websocket connections: %v", err)
+		}
+
+		// Closing gets its own time, so a drain that used up ctx still lets
+		// the close frames out.
+		closeCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownCloseTimeout)
+		defer cancel()
+		if err := manager.CloseAll(closeCtx); err != nil {
+			log.Printf("Failed to close websocket connections: %v", err)
+		}
+		if err := app.ShutdownWithContext(closeCtx); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+		if err := verifier.Close(); err != nil {
+			log.Printf("Failed to stop JWT verification: %v", err)
+		}
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close gRPC connection: %v", err)
+		}
+	}
 }
@@ -3,6 +3,7 @@ package websocket
 import (
 	"log"
 	"strconv"
+	"time"
 	e "websocket-service/internal/exception"
 	"websocket-service/internal/model"
 	"websocket-service/internal/service"
@@ -13,44 +14,108 @@ import (
 )
 
 type WebSocketController struct {
-	manager     *utils.WebSocketManager
-	chatService service.ChatService
+	manager         *utils.WebSocketManager
+	chatService     service.ChatService
+	ticketService   service.TicketService
+	typingService   service.TypingService
+	receiptService  service.ReceiptService
+	messageService  service.MessageService
+	reactionService service.ReactionService
+	verifier        *utils.TokenVerifier
+	router          *FrameRouter
 }
 
-func NewWebSocketController(manager *utils.WebSocketManager, chatService service.ChatService) *WebSocketController {
-	return &WebSocketController{
-		manager:     manager,
-		chatService: chatService,
+func NewWebSocketController(manager *utils.WebSocketManager, chatService service.ChatService, ticketService service.TicketService, typingService service.TypingService, receiptService service.ReceiptService, messageService service.MessageService, reactionService service.ReactionService, verifier *utils.TokenVerifier) *WebSocketController {
+	controller := &WebSocketController{
+		manager:         manager,
+		chatService:     chatService,
+		ticketService:   ticketService,
+		typingService:   typingService,
+		receiptService:  receiptService,
+		messageService:  messageService,
+		reactionService: reactionService,
+		verifier:        verifier,
+		router:          NewFrameRouter(),
 	}
+
+	controller.router.Handle(model.FrameTypeChatSend, controller.handleChatSend)
+	controller.router.Handle(model.FrameTypeReauth, controller.handleReauth)
+	controller.router.Handle(model.FrameTypeTypingStart, controller.handleTypingStart)
+	controller.router.Handle(model.FrameTypeTypingStop, controller.handleTypingStop)
+	controller.router.Handle(model.FrameTypeReceiptDelivered, controller.handleReceiptDelivered)
+	controller.router.Handle(model.FrameTypeReceiptRead, controller.handleReceiptRead)
+	controller.router.Handle(model.FrameTypeMessageEdit, controller.handleMessageEdit)
+	controller.router.Handle(model.FrameTypeMessageDelete, controller.handleMessageDelete)
+	controller.router.Handle(model.FrameTypeReactionAdd, controller.handleReactionAdd)
+	controller.router.Handle(model.FrameTypeReactionRemove, controller.handleReactionRemove)
+	controller.router.Handle(model.FrameTypeReactionList, controller.handleReactionList)
+	controller.router.Handle(model.FrameTypeThreadGet, controller.handleThreadGet)
+
+	return controller
 }
 
 func (controller *WebSocketController) Connect(c *websocket.Conn) {
-	userIdStr := c.Params("userId")
-	userId, err := strconv.Atoi(userIdStr)
+	if hsErr, ok := c.Locals(localHandshakeError).(*handshakeError); ok {
+		utils.CloseWithReason(c, hsErr.Code, hsErr.Reason)
+		return
+	}
 
-	if err != nil {
-		log.Printf("Invalid userId: %s", userIdStr)
+	claims, ok := c.Locals(localClaims).(*utils.Claims)
+	if !ok {
+		utils.CloseWithReason(c, utils.CloseUnauthorized, "missing token")
 		return
 	}
+	userId := c.Locals(localUserId).(int)
+	deviceId, _ := c.Locals(localDeviceId).(string)
 
 	log.Println("New connection for user", userId)
-	controller.manager.WebSocketEndpoint(c, userId, controller.chatService.ProcessMessage)
+	controller.manager.WebSocketEndpoint(c, userId, deviceId, claims, controller.dispatch)
 }
 
-func (controller *WebSocketController) Get(c *fiber.Ctx) error {
-	userIdStr := c.Params("userId")
-	userId, err := strconv.Atoi(userIdStr)
+// dispatch answers every frame with either an ack or an error frame carrying the
+// client's request id.
+func (controller *WebSocketController) dispatch(connInfo *utils.WebSocketConnInfo, frame model.FrameRequest) {
+	ack, err := controller.router.Dispatch(connInfo, frame)
 	if err != nil {
-		log.Printf("Invalid userId: %s", userIdStr)
-		return c.Status(fiber.StatusBadRequest).SendString("Invalid userId")
+		log.Printf("Failed to handle %s frame from user %d: %v", frame.Type, connInfo.UserId, err)
+		controller.manager.SendToConn(connInfo, model.NewErrorFrame(frame.RequestId, err))
+		return
+	}
+
+	ack.FrameType = frame.Type
+	if ack.Timestamp.IsZero() {
+		ack.Timestamp = time.Now()
+	}
+	controller.manager.SendToConn(connInfo, model.FrameResponse{
+		Type:      model.FrameTypeAck,
+		RequestId: frame.RequestId,
+		Payload:   ack,
+	})
+}
+
+func (controller *WebSocketController) Get(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	if controller.manager.Draining() {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(controller.manager.ReconnectAfter()))
+		return fiber.ErrServiceUnavailable
 	}
 
-	if websocket.IsWebSocketUpgrade(c) {
-		c.Locals("userId", userId)
+	claims, userId, hsErr := controller.authenticate(c)
+	if hsErr != nil {
+		log.Printf("Rejecting websocket from %s: %s", c.IP(), hsErr.Reason)
+		c.Locals(localHandshakeError, hsErr)
 		return c.Next()
 	}
 
-	return fiber.ErrUpgradeRequired
+	c.Locals(localClaims, claims)
+	c.Locals(localUserId, userId)
+	return c.Next()
+}
+
+func (controller *WebSocketController) parseToken(token string) (*utils.Claims, error) {
+	return controller.verifier.Parse(token)
 }
 
 func (controller *WebSocketController) job(c *fiber.Ctx) error {
@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"time"
+)
+
+type Message struct {
+	ID             uint32    `gorm:"primaryKey"`
+	ConversationID int       `gorm:"not null"`
+	SenderID       int       `gorm:"not null"`
+	ParentID       uint32    `gorm:"index"`
+	Content        string    `gorm:"type:text;not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	EditedAt       time.Time
+	DeletedAt      time.Time `gorm:"index"`
+}
+
+func (m Message) IsDeleted() bool {
+	return !m.DeletedAt.IsZero()
+}
@@ -5,8 +5,10 @@ import (
 )
 
 type Notification struct {
-	ID        uint      `gorm:"primaryKey"`
-	UserID    uint      `gorm:"not null"`
-	Message   string    `gorm:"type:text;not null"`
+	ID      uint   `gorm:"primaryKey"`
+	UserID  uint   `gorm:"not null"`
+	Message string `gorm:"type:text;not null"`
+	// DeviceID, when set, targets a single device of the user.
+	DeviceID  string    `gorm:"size:64"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
@@ -0,0 +1,14 @@
+package entity
+
+import (
+	"time"
+)
+
+// Reaction is one user's emoji on a message; a user reacts with a given emoji at most once.
+type Reaction struct {
+	MessageID      uint32    `gorm:"primaryKey"`
+	UserID         int       `gorm:"primaryKey"`
+	Emoji          string    `gorm:"primaryKey"`
+	ConversationID int       `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,19 @@
+package entity
+
+import (
+	"time"
+)
+
+// Receipt records how far a message has reached one of its recipients.
+type Receipt struct {
+	MessageID      uint32    `gorm:"primaryKey"`
+	UserID         int       `gorm:"primaryKey"`
+	ConversationID int       `gorm:"not null"`
+	Status         string    `gorm:"not null"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+const (
+	ReceiptStatusDelivered = "DELIVERED"
+	ReceiptStatusRead      = "READ"
+)
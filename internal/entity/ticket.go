@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"time"
+)
+
+// Ticket is a short-lived, single-use credential a browser redeems on the
+// WebSocket upgrade in place of the bearer token it was issued for.
+type Ticket struct {
+	ID        string
+	UserID    int
+	Token     string
+	ClientIP  string
+	ExpiresAt time.Time
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"log"
+	"strconv"
 )
 
 const IsHttpError = true
@@ -11,13 +12,18 @@ const (
 	TypeErrorNotFound     = "NotFound"
 	TypeErrorValidation   = "Validation"
 	TypeErrorUnauthorized = "Unauthorized"
+	TypeErrorForbidden    = "Forbidden"
 	TypeErrorInternal     = "Internal"
+	TypeErrorRateLimited  = "RateLimited"
 )
 
 type Err struct {
 	ErrorType string
 	ErrorCode int
 	Message   string
+	// RetryAfter is the wait in milliseconds before a rate limited request may
+	// be retried.
+	RetryAfter int64 `json:",omitempty"`
 }
 
 func (e Err) Error() string {
@@ -43,5 +49,8 @@ func Convert(err error) (Err, error) {
 func HandleHttpErrorFiber(c *fiber.Ctx, err error) error {
 	var msg, _ = Convert(err)
 	log.Println(msg)
+	if msg.RetryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt((msg.RetryAfter+999)/1000, 10))
+	}
 	return c.Status(msg.ErrorCode).JSON(fiber.Map{"errors": msg.Message})
 }
@@ -0,0 +1,23 @@
+package exception
+
+import "encoding/json"
+
+type ErrForbidden Err
+
+func Forbidden(message string) ErrForbidden {
+	return ErrForbidden{
+		ErrorType: TypeErrorForbidden,
+		ErrorCode: 403,
+		Message:   message,
+	}
+}
+
+func (e ErrForbidden) Error() string {
+	var msg string
+	if IsHttpError {
+		payload, _ := json.Marshal(e)
+		msg = string(payload)
+	}
+
+	return msg
+}
@@ -0,0 +1,27 @@
+package exception
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type ErrRateLimited Err
+
+func RateLimited(message string, retryAfter time.Duration) ErrRateLimited {
+	return ErrRateLimited{
+		ErrorType:  TypeErrorRateLimited,
+		ErrorCode:  429,
+		Message:    message,
+		RetryAfter: (retryAfter + time.Millisecond - 1).Milliseconds(),
+	}
+}
+
+func (e ErrRateLimited) Error() string {
+	var msg string
+	if IsHttpError {
+		payload, _ := json.Marshal(e)
+		msg = string(payload)
+	}
+
+	return msg
+}
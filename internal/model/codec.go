@@ -0,0 +1,45 @@
+package model
+
+// Codec serializes frames for the subprotocol a connection negotiated.
+type Codec interface {
+	// Encode serializes an outbound frame. A nil result means the frame has no
+	// representation in this codec and must not be sent.
+	Encode(frame FrameResponse) ([]byte, error)
+	// Decode parses an inbound frame, leaving its payload as JSON for Bind.
+	Decode(data []byte) (FrameRequest, error)
+	// Binary reports whether frames travel as binary rather than text messages.
+	Binary() bool
+}
+
+var (
+	LegacyCodec  Codec = legacyCodec{}
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+	ProtoCodec   Codec = protoCodec{}
+)
+
+// CodecFor maps the negotiated subprotocol to its codec. Clients negotiating
+// none of ours speak the legacy bare format.
+func CodecFor(subprotocol string) Codec {
+	switch subprotocol {
+	case SubprotocolV1, SubprotocolV1JSON:
+		return JSONCodec
+	case SubprotocolV1Msgpack:
+		return MsgpackCodec
+	case SubprotocolV1Proto:
+		return ProtoCodec
+	}
+	return LegacyCodec
+}
+
+type legacyCodec struct{}
+
+func (legacyCodec) Encode(frame FrameResponse) ([]byte, error) { return frame.Encode(0) }
+func (legacyCodec) Decode(data []byte) (FrameRequest, error)   { return DecodeFrame(data) }
+func (legacyCodec) Binary() bool                               { return false }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(frame FrameResponse) ([]byte, error) { return frame.Encode(ProtocolVersion) }
+func (jsonCodec) Decode(data []byte) (FrameRequest, error)   { return DecodeFrame(data) }
+func (jsonCodec) Binary() bool                               { return false }
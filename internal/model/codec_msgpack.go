@@ -0,0 +1,52 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackCodec carries the same envelope and field names as the JSON one,
+// encoded as MessagePack.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(frame FrameResponse) ([]byte, error) {
+	frame.Version = ProtocolVersion
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(frame); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(data []byte) (FrameRequest, error) {
+	var envelope struct {
+		Version   int         `msgpack:"v"`
+		Type      string      `msgpack:"type"`
+		RequestId string      `msgpack:"request_id"`
+		Payload   interface{} `msgpack:"payload"`
+	}
+
+	frame := FrameRequest{}
+	if err := msgpack.Unmarshal(data, &envelope); err != nil {
+		return frame, err
+	}
+	frame.Version = envelope.Version
+	frame.Type = envelope.Type
+	frame.RequestId = envelope.RequestId
+
+	if envelope.Payload != nil {
+		payload, err := json.Marshal(envelope.Payload)
+		if err != nil {
+			return frame, err
+		}
+		frame.Payload = payload
+	}
+	return frame, frame.validate()
+}
+
+func (msgpackCodec) Binary() bool { return true }
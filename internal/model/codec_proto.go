@@ -0,0 +1,114 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// protoCodec encodes frames as the Protocol Buffers message
+//
+//	message Frame {
+//	  uint32 v = 1;
+//	  string type = 2;
+//	  string request_id = 3;
+//	  google.protobuf.Struct payload = 4;
+//	}
+//
+// with the payload carrying the same fields as the JSON one.
+type protoCodec struct{}
+
+const (
+	protoFieldVersion   protowire.Number = 1
+	protoFieldType      protowire.Number = 2
+	protoFieldRequestId protowire.Number = 3
+	protoFieldPayload   protowire.Number = 4
+)
+
+func (protoCodec) Encode(frame FrameResponse) ([]byte, error) {
+	var data []byte
+	data = protowire.AppendTag(data, protoFieldVersion, protowire.VarintType)
+	data = protowire.AppendVarint(data, ProtocolVersion)
+	data = protowire.AppendTag(data, protoFieldType, protowire.BytesType)
+	data = protowire.AppendString(data, frame.Type)
+	if frame.RequestId != "" {
+		data = protowire.AppendTag(data, protoFieldRequestId, protowire.BytesType)
+		data = protowire.AppendString(data, frame.RequestId)
+	}
+
+	if frame.Payload != nil {
+		payload, err := toStruct(frame.Payload)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := proto.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		data = protowire.AppendTag(data, protoFieldPayload, protowire.BytesType)
+		data = protowire.AppendBytes(data, encoded)
+	}
+	return data, nil
+}
+
+func (protoCodec) Decode(data []byte) (FrameRequest, error) {
+	frame := FrameRequest{}
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return frame, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case number == protoFieldVersion && wireType == protowire.VarintType:
+			var version uint64
+			version, n = protowire.ConsumeVarint(data)
+			frame.Version = int(version)
+		case number == protoFieldType && wireType == protowire.BytesType:
+			frame.Type, n = protowire.ConsumeString(data)
+		case number == protoFieldRequestId && wireType == protowire.BytesType:
+			frame.RequestId, n = protowire.ConsumeString(data)
+		case number == protoFieldPayload && wireType == protowire.BytesType:
+			var encoded []byte
+			encoded, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				payload := &structpb.Struct{}
+				if err := proto.Unmarshal(encoded, payload); err != nil {
+					return frame, err
+				}
+				var err error
+				if frame.Payload, err = json.Marshal(payload.AsMap()); err != nil {
+					return frame, err
+				}
+			}
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		}
+		if n < 0 {
+			return frame, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return frame, frame.validate()
+}
+
+func (protoCodec) Binary() bool { return true }
+
+// toStruct converts a payload to a Struct by way of its JSON form, so both
+// codecs agree on field names.
+func toStruct(payload interface{}) (*structpb.Struct, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, errors.New("payload is not an object")
+	}
+	return structpb.NewStruct(fields)
+}
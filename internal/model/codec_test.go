@@ -0,0 +1,183 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestCodecFor(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        Codec
+	}{
+		{"", LegacyCodec},
+		{"chat.v2", LegacyCodec},
+		{SubprotocolV1, JSONCodec},
+		{SubprotocolV1JSON, JSONCodec},
+		{SubprotocolV1Msgpack, MsgpackCodec},
+		{SubprotocolV1Proto, ProtoCodec},
+	}
+	for _, test := range tests {
+		if got := CodecFor(test.subprotocol); got != test.want {
+			t.Errorf("CodecFor(%q) = %T, want %T", test.subprotocol, got, test.want)
+		}
+	}
+}
+
+// Servers and clients share the envelope, so an encoded response decodes as a
+// request carrying the same payload.
+func TestCodecRoundTrip(t *testing.T) {
+	sent := ChatMessagePayload{
+		MessageId:      4294967295,
+		ConversationId: 7,
+		SenderId:       3,
+		ParentId:       12,
+		Message:        "héllo \"world\" 👋",
+		SentAt:         time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+	frame := FrameResponse{Type: FrameTypeChatMessage, RequestId: "req-1", Payload: sent}
+
+	for name, codec := range map[string]Codec{"json": JSONCodec, "msgpack": MsgpackCodec, "proto": ProtoCodec} {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Encode(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Version != ProtocolVersion || decoded.Type != frame.Type || decoded.RequestId != frame.RequestId {
+				t.Fatalf("got envelope v=%d type=%q request_id=%q", decoded.Version, decoded.Type, decoded.RequestId)
+			}
+
+			var received ChatMessagePayload
+			if err := decoded.Bind(&received); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(received, sent) {
+				t.Fatalf("got payload %+v, want %+v", received, sent)
+			}
+		})
+	}
+}
+
+func TestCodecRoundTripWithoutPayload(t *testing.T) {
+	for name, codec := range map[string]Codec{"json": JSONCodec, "msgpack": MsgpackCodec, "proto": ProtoCodec} {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Encode(FrameResponse{Type: FrameTypeTypingStop})
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Type != FrameTypeTypingStop || decoded.RequestId != "" {
+				t.Fatalf("got type %q request_id %q", decoded.Type, decoded.RequestId)
+			}
+			if err := decoded.Bind(&struct{}{}); err == nil {
+				t.Fatal("missing payload bound without error")
+			}
+		})
+	}
+}
+
+func TestLegacyCodec(t *testing.T) {
+	data, err := LegacyCodec.Encode(FrameResponse{Type: FrameTypeChatMessage, Payload: ChatMessagePayload{Message: "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy MessageResponse
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy != (MessageResponse{MessageType: MessageTypeChat, Message: "hi"}) {
+		t.Fatalf("got %+v", legacy)
+	}
+
+	// Frames legacy clients never knew about are not sent to them at all.
+	data, err = LegacyCodec.Encode(FrameResponse{Type: FrameTypeTyping, Payload: TypingPayload{ConversationId: 1}})
+	if err != nil || data != nil {
+		t.Fatalf("got %q, %v for a frame without a legacy form", data, err)
+	}
+
+	// Legacy clients send chat messages bare, without a type.
+	bare := []byte(`{"message":"hi","conversation_id":7}`)
+	decoded, err := LegacyCodec.Decode(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != 0 || decoded.Type != FrameTypeChatSend || string(decoded.Payload) != string(bare) {
+		t.Fatalf("got %+v", decoded)
+	}
+}
+
+func TestCodecRejectsMalformedInput(t *testing.T) {
+	msgpackFrame := func(v map[string]interface{}) []byte {
+		data, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	protoFrame := func(version uint64, frameType string) []byte {
+		var data []byte
+		data = protowire.AppendTag(data, protoFieldVersion, protowire.VarintType)
+		data = protowire.AppendVarint(data, version)
+		if frameType != "" {
+			data = protowire.AppendTag(data, protoFieldType, protowire.BytesType)
+			data = protowire.AppendString(data, frameType)
+		}
+		return data
+	}
+	valid := protoFrame(ProtocolVersion, FrameTypeChatSend)
+	badPayload := protowire.AppendTag(protoFrame(ProtocolVersion, FrameTypeChatSend), protoFieldPayload, protowire.BytesType)
+	badPayload = protowire.AppendBytes(badPayload, []byte{0xff, 0xff})
+
+	tests := []struct {
+		name  string
+		codec Codec
+		data  []byte
+	}{
+		{"json: not json", JSONCodec, []byte("{not json")},
+		{"json: empty", JSONCodec, nil},
+		{"json: wrong field type", JSONCodec, []byte(`{"v":"1","type":"chat.send"}`)},
+		{"json: unsupported version", JSONCodec, []byte(`{"v":2,"type":"chat.send"}`)},
+		{"json: negative version", JSONCodec, []byte(`{"v":-1,"type":"chat.send"}`)},
+		{"json: missing type", JSONCodec, []byte(`{"v":1}`)},
+		{"legacy: not json", LegacyCodec, []byte("hello")},
+
+		{"msgpack: garbage", MsgpackCodec, []byte{0xc1}},
+		{"msgpack: truncated", MsgpackCodec, msgpackFrame(map[string]interface{}{"v": 1, "type": "chat.send"})[:5]},
+		{"msgpack: empty", MsgpackCodec, nil},
+		{"msgpack: not a map", MsgpackCodec, msgpackFrame(nil)},
+		{"msgpack: unsupported version", MsgpackCodec, msgpackFrame(map[string]interface{}{"v": 2, "type": "chat.send"})},
+		{"msgpack: missing type", MsgpackCodec, msgpackFrame(map[string]interface{}{"v": 1})},
+
+		{"proto: empty", ProtoCodec, nil},
+		{"proto: truncated", ProtoCodec, valid[:len(valid)-1]},
+		{"proto: bad tag", ProtoCodec, []byte{0xff}},
+		{"proto: payload is not a struct", ProtoCodec, badPayload},
+		{"proto: unsupported version", ProtoCodec, protoFrame(2, FrameTypeChatSend)},
+		{"proto: missing type", ProtoCodec, protoFrame(ProtocolVersion, "")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if frame, err := test.codec.Decode(test.data); err == nil {
+				t.Fatalf("malformed frame decoded as %+v", frame)
+			}
+		})
+	}
+}
+
+func TestProtoCodecRejectsNonObjectPayload(t *testing.T) {
+	if _, err := ProtoCodec.Encode(FrameResponse{Type: FrameTypeNotification, Payload: "hi"}); err == nil {
+		t.Fatal("non-object payload encoded")
+	}
+}
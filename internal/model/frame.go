@@ -0,0 +1,277 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	e "websocket-service/internal/exception"
+)
+
+// ProtocolVersion is the current version of the frame envelope. Version 0 is the
+// legacy bare format ({"message", "conversation_id"} in, MessageResponse out).
+const ProtocolVersion = 1
+
+// Subprotocols negotiated by clients speaking the versioned envelope. The
+// suffix picks the codec; plain SubprotocolV1 is JSON.
+const (
+	SubprotocolV1        = "chat.v1"
+	SubprotocolV1JSON    = "chat.v1.json"
+	SubprotocolV1Msgpack = "chat.v1.msgpack"
+	SubprotocolV1Proto   = "chat.v1.proto"
+)
+
+// Inbound frame types.
+const (
+	FrameTypeChatSend    = "chat.send"
+	FrameTypeReauth      = "reauth"
+	FrameTypeTypingStart = "typing.start"
+	FrameTypeTypingStop  = "typing.stop"
+
+	FrameTypeReceiptDelivered = "receipt.delivered"
+	FrameTypeReceiptRead      = "receipt.read"
+
+	FrameTypeMessageEdit   = "message.edit"
+	FrameTypeMessageDelete = "message.delete"
+
+	FrameTypeReactionAdd    = "reaction.add"
+	FrameTypeReactionRemove = "reaction.remove"
+	FrameTypeReactionList   = "reaction.list"
+
+	FrameTypeThreadGet = "thread.get"
+)
+
+// Outbound frame types.
+const (
+	FrameTypeChatMessage    = "chat.message"
+	FrameTypeNotification   = "notification"
+	FrameTypeTyping         = "typing"
+	FrameTypeReceipt        = "receipt"
+	FrameTypeMessageUpdated = "message.updated"
+	FrameTypeMessageDeleted = "message.deleted"
+	FrameTypeReaction       = "reaction"
+	FrameTypeAck            = "ack"
+	FrameTypeError          = "error"
+	FrameTypeTokenExpiring  = "token.expiring"
+	FrameTypeShutdown       = "shutdown"
+)
+
+// FrameRequest is the envelope of every frame a client sends.
+type FrameRequest struct {
+	Version   int             `json:"v"`
+	Type      string          `json:"type"`
+	RequestId string          `json:"request_id,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// FrameResponse is the envelope of every frame the server sends.
+type FrameResponse struct {
+	Version   int         `json:"v"`
+	Type      string      `json:"type"`
+	RequestId string      `json:"request_id,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+type ChatMessagePayload struct {
+	MessageId      uint32    `json:"message_id"`
+	ConversationId int       `json:"conversation_id"`
+	SenderId       int       `json:"sender_id"`
+	ParentId       uint32    `json:"parent_id,omitempty"`
+	Message        string    `json:"message"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+type MessageUpdatedPayload struct {
+	MessageId      uint32    `json:"message_id"`
+	ConversationId int       `json:"conversation_id"`
+	SenderId       int       `json:"sender_id"`
+	Message        string    `json:"message"`
+	EditedBy       int       `json:"edited_by"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+// MessageDeletedPayload is the tombstone left in place of a deleted message.
+type MessageDeletedPayload struct {
+	MessageId      uint32    `json:"message_id"`
+	ConversationId int       `json:"conversation_id"`
+	SenderId       int       `json:"sender_id"`
+	DeletedBy      int       `json:"deleted_by"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
+
+type NotificationPayload struct {
+	Message string `json:"message"`
+}
+
+type TypingPayload struct {
+	ConversationId int  `json:"conversation_id"`
+	UserId         int  `json:"user_id"`
+	Typing         bool `json:"typing"`
+}
+
+// ReceiptPayload tells a sender that one recipient got or read their message,
+// along with the totals so far across all recipients.
+type ReceiptPayload struct {
+	ConversationId int    `json:"conversation_id"`
+	MessageId      uint32 `json:"message_id"`
+	UserId         int    `json:"user_id"`
+	Status         string `json:"status"`
+	DeliveredCount int    `json:"delivered_count"`
+	ReadCount      int    `json:"read_count"`
+	RecipientCount int    `json:"recipient_count"`
+}
+
+// ReactionPayload carries the reaction totals of a message. UserId, Emoji and
+// Action describe the change that triggered it and are empty when the totals
+// were requested with reaction.list.
+type ReactionPayload struct {
+	ConversationId int            `json:"conversation_id"`
+	MessageId      uint32         `json:"message_id"`
+	UserId         int            `json:"user_id,omitempty"`
+	Emoji          string         `json:"emoji,omitempty"`
+	Action         string         `json:"action,omitempty"`
+	Counts         map[string]int `json:"counts"`
+}
+
+const (
+	ReactionActionAdd    = "add"
+	ReactionActionRemove = "remove"
+)
+
+// AckPayload answers every successfully handled inbound frame.
+type AckPayload struct {
+	// FrameType is the type of the acknowledged frame.
+	FrameType string    `json:"frame_type"`
+	MessageId uint32    `json:"message_id,omitempty"`
+	ExpiresAt string    `json:"expires_at,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type ErrorPayload struct {
+	Code    int    `json:"code"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// RetryAfterMs tells rate limited clients how long to wait before retrying.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+type TokenPayload struct {
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// ShutdownPayload tells clients the server is going away and how many seconds
+// to wait before reconnecting.
+type ShutdownPayload struct {
+	ReconnectAfter int `json:"reconnect_after"`
+}
+
+// NewErrorFrame reports err to the client, correlated with the failed request.
+// Internal errors are not detailed, as they may carry backend internals.
+func NewErrorFrame(requestId string, err error) FrameResponse {
+	var payload ErrorPayload
+	switch err := err.(type) {
+	case e.ErrValidation:
+		payload = newErrorPayload(e.Err(err))
+	case e.ErrNotFound:
+		payload = newErrorPayload(e.Err(err))
+	case e.ErrUnauthorized:
+		payload = newErrorPayload(e.Err(err))
+	case e.ErrForbidden:
+		payload = newErrorPayload(e.Err(err))
+	case e.ErrRateLimited:
+		payload = newErrorPayload(e.Err(err))
+	default:
+		payload = ErrorPayload{
+			Code:    500,
+			Type:    e.TypeErrorInternal,
+			Message: "internal server error",
+		}
+	}
+
+	return FrameResponse{
+		Type:      FrameTypeError,
+		RequestId: requestId,
+		Payload:   payload,
+	}
+}
+
+func newErrorPayload(err e.Err) ErrorPayload {
+	return ErrorPayload{
+		Code:         err.ErrorCode,
+		Type:         err.ErrorType,
+		Message:      err.Message,
+		RetryAfterMs: err.RetryAfter,
+	}
+}
+
+func DecodeFrame(data []byte) (FrameRequest, error) {
+	var frame FrameRequest
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return frame, err
+	}
+
+	if frame.Version == 0 {
+		// Legacy clients send the payload bare, and chat messages without a type.
+		if frame.Type == "" {
+			frame.Type = FrameTypeChatSend
+		}
+		frame.Payload = data
+		return frame, nil
+	}
+
+	return frame, frame.validate()
+}
+
+func (frame FrameRequest) validate() error {
+	if frame.Version < 1 || frame.Version > ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", frame.Version)
+	}
+	if frame.Type == "" {
+		return errors.New("missing frame type")
+	}
+	return nil
+}
+
+// Bind decodes the frame payload into v.
+func (frame FrameRequest) Bind(v interface{}) error {
+	if len(frame.Payload) == 0 {
+		return errors.New("missing payload")
+	}
+	return json.Unmarshal(frame.Payload, v)
+}
+
+// Legacy returns the bare representation of the frame for version 0 clients, or
+// false when the frame has none and must not be sent to them.
+func (frame FrameResponse) Legacy() (MessageResponse, bool) {
+	switch payload := frame.Payload.(type) {
+	case ChatMessagePayload:
+		return MessageResponse{MessageType: MessageTypeChat, Message: payload.Message}, true
+	case NotificationPayload:
+		return MessageResponse{MessageType: MessageTypeNotification, Message: payload.Message}, true
+	case ErrorPayload:
+		return MessageResponse{MessageType: MessageTypeError, Message: payload.Message}, true
+	case TokenPayload:
+		return MessageResponse{MessageType: MessageTypeTokenExpiring, Message: payload.ExpiresAt}, true
+	case AckPayload:
+		// Legacy clients only ever had their reauth acknowledged.
+		if payload.FrameType == FrameTypeReauth {
+			return MessageResponse{MessageType: MessageTypeReauthenticated, Message: payload.ExpiresAt}, true
+		}
+	}
+	return MessageResponse{}, false
+}
+
+// Encode serializes the frame for a client speaking the given protocol version.
+// A nil result means the frame has no representation in that version.
+func (frame FrameResponse) Encode(version int) ([]byte, error) {
+	if version == 0 {
+		legacy, ok := frame.Legacy()
+		if !ok {
+			return nil, nil
+		}
+		return json.Marshal(legacy)
+	}
+
+	frame.Version = version
+	return json.Marshal(frame)
+}
@@ -3,6 +3,16 @@ package model
 type MessageRequest struct {
 	Message        string `json:"message"`
 	ConversationId int    `json:"conversation_id"`
+	// ParentId makes the message a reply in the thread of that message.
+	ParentId uint32 `json:"parent_id,omitempty"`
+	// IncludeOrigin echoes the message back to the connection it was sent from,
+	// which otherwise only gets the ack.
+	IncludeOrigin bool `json:"include_origin,omitempty"`
+}
+
+type ThreadRequest struct {
+	ConversationId int    `json:"conversation_id" validate:"required"`
+	ParentId       uint32 `json:"parent_id" validate:"required"`
 }
 
 var DummyConversation = map[int][]int{
@@ -8,4 +8,8 @@ type MessageResponse struct {
 const (
 	MessageTypeChat         = "CHAT"
 	MessageTypeNotification = "NOTIFICATION"
+	MessageTypeError        = "ERROR"
+
+	MessageTypeTokenExpiring   = "TOKEN_EXPIRING"
+	MessageTypeReauthenticated = "REAUTHENTICATED"
 )
@@ -0,0 +1,12 @@
+package model
+
+type EditMessageRequest struct {
+	ConversationId int    `json:"conversation_id" validate:"required"`
+	MessageId      uint32 `json:"message_id" validate:"required"`
+	Message        string `json:"message" validate:"required"`
+}
+
+type DeleteMessageRequest struct {
+	ConversationId int    `json:"conversation_id" validate:"required"`
+	MessageId      uint32 `json:"message_id" validate:"required"`
+}
@@ -0,0 +1,12 @@
+package model
+
+type ReactionRequest struct {
+	ConversationId int    `json:"conversation_id" validate:"required"`
+	MessageId      uint32 `json:"message_id" validate:"required"`
+	Emoji          string `json:"emoji" validate:"required,max=64"`
+}
+
+type ReactionListRequest struct {
+	ConversationId int      `json:"conversation_id" validate:"required"`
+	MessageIds     []uint32 `json:"message_ids" validate:"required,min=1,max=100"`
+}
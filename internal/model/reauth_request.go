@@ -0,0 +1,5 @@
+package model
+
+type ReauthRequest struct {
+	Token string `json:"token" validate:"required"`
+}
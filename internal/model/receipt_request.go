@@ -0,0 +1,6 @@
+package model
+
+type ReceiptRequest struct {
+	ConversationId int      `json:"conversation_id" validate:"required"`
+	MessageIds     []uint32 `json:"message_ids" validate:"required,min=1,max=100"`
+}
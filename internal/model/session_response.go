@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// SessionResponse describes a live connection.
+type SessionResponse struct {
+	SessionId   uint64    `json:"session_id"`
+	UserId      int       `json:"user_id"`
+	DeviceId    string    `json:"device_id,omitempty"`
+	RemoteAddr  string    `json:"remote_addr"`
+	Subprotocol string    `json:"subprotocol,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// BytesSent counts the payload of the frames written, before compression.
+	BytesSent  uint64 `json:"bytes_sent"`
+	QueueDepth int    `json:"queue_depth"`
+}
+
+type UserSessionsResponse struct {
+	UserId   int               `json:"user_id"`
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// QueueStatsResponse sums up the send queues of every connection, listing the
+// ones with frames waiting, deepest first.
+type QueueStatsResponse struct {
+	Connections   int               `json:"connections"`
+	QueueCapacity int               `json:"queue_capacity"`
+	Queued        int               `json:"queued"`
+	MaxDepth      int               `json:"max_depth"`
+	FullQueues    int               `json:"full_queues"`
+	Backlogged    []SessionResponse `json:"backlogged"`
+}
+
+type DisconnectRequest struct {
+	// Reason is sent to the client in the close frame, which caps its length
+	// at utils.MaxCloseReasonLength bytes.
+	Reason string `json:"reason"`
+}
+
+type DisconnectResponse struct {
+	Disconnected int `json:"disconnected"`
+}
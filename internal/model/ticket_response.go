@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresIn int       `json:"expires_in"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
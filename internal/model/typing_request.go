@@ -0,0 +1,5 @@
+package model
+
+type TypingRequest struct {
+	ConversationId int `json:"conversation_id" validate:"required"`
+}
@@ -1,6 +1,21 @@
 package repository
 
+import "websocket-service/internal/entity"
+
 type ChatRepository interface {
 	GetConversation(conversationId int) ([]uint32, error)
-	SendMessage(conversationId int, senderId int, content string) error
+	SendMessage(conversationId int, senderId int, content string, parentId uint32) (entity.Message, error)
+	GetMessages(conversationId int) ([]entity.Message, error)
+	// GetThread returns the replies to a message, oldest first.
+	GetThread(conversationId int, parentId uint32) ([]entity.Message, error)
+	// UpdateMessage stores an edited or deleted (tombstoned) message.
+	UpdateMessage(message entity.Message) error
+	// SaveReceipts stores receipts; a read receipt is never downgraded to delivered.
+	SaveReceipts(receipts []entity.Receipt) error
+	GetReceipts(messageIds []uint32) ([]entity.Receipt, error)
+	// SaveReaction reports whether the reaction was not already there.
+	SaveReaction(reaction entity.Reaction) (bool, error)
+	// DeleteReaction reports whether there was a reaction to remove.
+	DeleteReaction(messageId uint32, userId int, emoji string) (bool, error)
+	GetReactions(messageIds []uint32) ([]entity.Reaction, error)
 }
@@ -2,30 +2,84 @@ package grpc
 
 import (
 	"context"
+	"fmt"
 	"github.com/MochJuang/chat-grpc/service/chat"
 	"google.golang.org/grpc"
 	"log"
+	"sort"
+	"sync"
+	"time"
+	"websocket-service/internal/entity"
 	e "websocket-service/internal/exception"
 	"websocket-service/internal/repository"
 )
 
 type chatRepository struct {
-	client           chat.ChatServiceClient
-	conversationData map[int][]uint32
+	client chat.ChatServiceClient
+	// Participants are cached for conversationTTL, so removing someone from a
+	// conversation takes effect within that time. Zero disables the cache.
+	conversationData map[int]cachedConversation
+	conversationTTL  time.Duration
+	mu               sync.RWMutex
+
+	// sendLocks serializes the sends of a sender, see SendMessage.
+	sendLocks [64]sync.Mutex
+
+	// The chat backend has no receipt RPC yet, so receipts are kept here, for
+	// the last maxTrackedMessages messages. They survive client reconnects but
+	// not a restart, and clients served by other instances never see them, so
+	// receipts only work with a single instance.
+	receipts   *messageStore[map[int]entity.Receipt]
+	receiptsMu sync.RWMutex
+
+	// Neither has it edit or delete RPCs nor a notion of threads; persisting
+	// them needs new chat-grpc RPCs and is out of scope here. Until then,
+	// updated messages and reply parents of the last maxTrackedMessages
+	// messages are kept here and overlaid on the messages it returns. Like
+	// receipts, they are lost on restart and only work with a single instance.
+	updates *messageStore[entity.Message]
+	parents *messageStore[uint32]
+	// deleted is never evicted, so a deleted message cannot come back while
+	// this process runs once its tombstone has left updates.
+	deleted   map[uint32]time.Time
+	updatesMu sync.RWMutex
+
+	// Reactions are kept here for the same reason and with the same limits as
+	// receipts: the last maxTrackedMessages messages, on a single instance.
+	reactions   *messageStore[map[reactionKey]entity.Reaction]
+	reactionsMu sync.RWMutex
+}
+
+type cachedConversation struct {
+	participants []uint32
+	expiresAt    time.Time
 }
 
-func NewChatRepository(client *grpc.ClientConn) repository.ChatRepository {
+type reactionKey struct {
+	userId int
+	emoji  string
+}
+
+func NewChatRepository(client *grpc.ClientConn, conversationTTL time.Duration, maxTrackedMessages int) repository.ChatRepository {
 	return &chatRepository{
 		client:           chat.NewChatServiceClient(client),
-		conversationData: make(map[int][]uint32),
+		conversationData: make(map[int]cachedConversation),
+		conversationTTL:  conversationTTL,
+		receipts:         newMessageStore[map[int]entity.Receipt](maxTrackedMessages),
+		updates:          newMessageStore[entity.Message](maxTrackedMessages),
+		parents:          newMessageStore[uint32](maxTrackedMessages),
+		deleted:          make(map[uint32]time.Time),
+		reactions:        newMessageStore[map[reactionKey]entity.Reaction](maxTrackedMessages),
 	}
 }
 
 func (r *chatRepository) GetConversation(conversationId int) ([]uint32, error) {
 
-	log.Println("Conversations:", r.conversationData)
-	if participants, ok := r.conversationData[conversationId]; ok {
-		return participants, nil
+	r.mu.RLock()
+	cached, ok := r.conversationData[conversationId]
+	r.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.participants, nil
 	}
 
 	req := &chat.ConversationRequest{
@@ -38,21 +92,251 @@ func (r *chatRepository) GetConversation(conversationId int) ([]uint32, error) {
 		return nil, e.NotFound("Conversation not found")
 	}
 
-	r.conversationData[conversationId] = res.ParticipantIds
+	if r.conversationTTL > 0 {
+		r.mu.Lock()
+		r.evictExpiredConversations()
+		r.conversationData[conversationId] = cachedConversation{
+			participants: res.ParticipantIds,
+			expiresAt:    time.Now().Add(r.conversationTTL),
+		}
+		r.mu.Unlock()
+	}
 	return res.ParticipantIds, nil
 }
 
-func (r *chatRepository) SendMessage(conversationId int, senderId int, content string) error {
+// evictExpiredConversations keeps the cache from growing with every
+// conversation ever looked up. The caller holds mu.
+func (r *chatRepository) evictExpiredConversations() {
+	now := time.Now()
+	for conversationId, cached := range r.conversationData {
+		if !now.Before(cached.expiresAt) {
+			delete(r.conversationData, conversationId)
+		}
+	}
+}
+
+// SendMessage stores the message and learns the id the backend gave it.
+// AddMessageToConversation does not return that id (chat-grpc would need to
+// include it in AddMessageResponse), so it is recovered by diffing the
+// conversation before and after the add. Sends of a sender are serialized on
+// this instance so their own messages cannot be mistaken for one another;
+// when the new message still cannot be told apart, an error is returned
+// rather than a wrong id.
+func (r *chatRepository) SendMessage(conversationId int, senderId int, content string, parentId uint32) (entity.Message, error) {
+	lock := &r.sendLocks[uint32(senderId)%uint32(len(r.sendLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	before, err := r.client.GetConversationDetails(context.Background(), &chat.ConversationRequest{
+		ConversationId: uint32(conversationId),
+	})
+	if err != nil {
+		return entity.Message{}, e.Internal(err)
+	}
+	var lastId uint32
+	for _, stored := range before.Messages {
+		if stored.Id > lastId {
+			lastId = stored.Id
+		}
+	}
+
 	req := &chat.AddMessageRequest{
 		ConversationId: uint32(conversationId),
 		SenderId:       uint32(senderId),
 		Content:        content,
 	}
 
-	_, err := r.client.AddMessageToConversation(context.Background(), req)
+	_, err = r.client.AddMessageToConversation(context.Background(), req)
+	if err != nil {
+		return entity.Message{}, e.Internal(err)
+	}
+
+	after, err := r.client.GetConversationDetails(context.Background(), &chat.ConversationRequest{
+		ConversationId: uint32(conversationId),
+	})
+	if err != nil {
+		return entity.Message{}, e.Internal(fmt.Errorf("message stored but its id is unknown: %w", err))
+	}
+
+	var matches []*chat.Message
+	for _, stored := range after.Messages {
+		if stored.Id > lastId && stored.SenderId == uint32(senderId) && stored.Content == content {
+			matches = append(matches, stored)
+		}
+	}
+	if len(matches) != 1 {
+		return entity.Message{}, e.Internal(fmt.Errorf("message stored but its id is unknown: %d candidates", len(matches)))
+	}
+
+	message := entity.Message{
+		ID:             matches[0].Id,
+		ConversationID: conversationId,
+		SenderID:       senderId,
+		ParentID:       parentId,
+		Content:        content,
+		CreatedAt:      parseTimestamp(matches[0].CreatedAt, time.Now()),
+	}
+
+	if parentId != 0 {
+		r.updatesMu.Lock()
+		r.parents.set(message.ID, parentId)
+		r.updatesMu.Unlock()
+	}
+
+	return message, nil
+}
+
+func (r *chatRepository) GetMessages(conversationId int) ([]entity.Message, error) {
+	req := &chat.ConversationRequest{
+		ConversationId: uint32(conversationId),
+	}
+
+	res, err := r.client.GetConversationDetails(context.Background(), req)
+	if err != nil {
+		log.Println("Error getting conversation details:", err)
+		return nil, e.NotFound("Conversation not found")
+	}
+
+	r.updatesMu.RLock()
+	defer r.updatesMu.RUnlock()
+
+	messages := make([]entity.Message, 0, len(res.Messages))
+	for _, stored := range res.Messages {
+		if updated, ok := r.updates.get(stored.Id); ok {
+			messages = append(messages, updated)
+			continue
+		}
+		parentId, _ := r.parents.get(stored.Id)
+
+		message := entity.Message{
+			ID:             stored.Id,
+			ConversationID: conversationId,
+			SenderID:       int(stored.SenderId),
+			ParentID:       parentId,
+			Content:        stored.Content,
+			CreatedAt:      parseTimestamp(stored.CreatedAt, time.Time{}),
+		}
+		if deletedAt, ok := r.deleted[stored.Id]; ok {
+			message.Content = ""
+			message.DeletedAt = deletedAt
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (r *chatRepository) GetThread(conversationId int, parentId uint32) ([]entity.Message, error) {
+	messages, err := r.GetMessages(conversationId)
 	if err != nil {
-		return e.Internal(err)
+		return nil, err
 	}
 
+	var replies []entity.Message
+	for _, message := range messages {
+		if message.ParentID == parentId {
+			replies = append(replies, message)
+		}
+	}
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].ID < replies[j].ID
+	})
+	return replies, nil
+}
+
+func (r *chatRepository) UpdateMessage(message entity.Message) error {
+	r.updatesMu.Lock()
+	defer r.updatesMu.Unlock()
+
+	r.updates.set(message.ID, message)
+	if message.IsDeleted() {
+		r.deleted[message.ID] = message.DeletedAt
+	}
+	return nil
+}
+
+func (r *chatRepository) SaveReceipts(receipts []entity.Receipt) error {
+	r.receiptsMu.Lock()
+	defer r.receiptsMu.Unlock()
+
+	for _, receipt := range receipts {
+		byUser, ok := r.receipts.get(receipt.MessageID)
+		if !ok {
+			byUser = make(map[int]entity.Receipt)
+			r.receipts.set(receipt.MessageID, byUser)
+		}
+
+		if existing, ok := byUser[receipt.UserID]; ok && existing.Status == entity.ReceiptStatusRead {
+			continue
+		}
+		byUser[receipt.UserID] = receipt
+	}
 	return nil
 }
+
+func (r *chatRepository) GetReceipts(messageIds []uint32) ([]entity.Receipt, error) {
+	r.receiptsMu.RLock()
+	defer r.receiptsMu.RUnlock()
+
+	var receipts []entity.Receipt
+	for _, messageId := range messageIds {
+		byUser, _ := r.receipts.get(messageId)
+		for _, receipt := range byUser {
+			receipts = append(receipts, receipt)
+		}
+	}
+	return receipts, nil
+}
+
+func (r *chatRepository) SaveReaction(reaction entity.Reaction) (bool, error) {
+	r.reactionsMu.Lock()
+	defer r.reactionsMu.Unlock()
+
+	byKey, ok := r.reactions.get(reaction.MessageID)
+	if !ok {
+		byKey = make(map[reactionKey]entity.Reaction)
+		r.reactions.set(reaction.MessageID, byKey)
+	}
+
+	key := reactionKey{userId: reaction.UserID, emoji: reaction.Emoji}
+	if _, ok := byKey[key]; ok {
+		return false, nil
+	}
+	byKey[key] = reaction
+	return true, nil
+}
+
+func (r *chatRepository) DeleteReaction(messageId uint32, userId int, emoji string) (bool, error) {
+	r.reactionsMu.Lock()
+	defer r.reactionsMu.Unlock()
+
+	byKey, _ := r.reactions.get(messageId)
+	key := reactionKey{userId: userId, emoji: emoji}
+	if _, ok := byKey[key]; !ok {
+		return false, nil
+	}
+	delete(byKey, key)
+	return true, nil
+}
+
+func (r *chatRepository) GetReactions(messageIds []uint32) ([]entity.Reaction, error) {
+	r.reactionsMu.RLock()
+	defer r.reactionsMu.RUnlock()
+
+	var reactions []entity.Reaction
+	for _, messageId := range messageIds {
+		byKey, _ := r.reactions.get(messageId)
+		for _, reaction := range byKey {
+			reactions = append(reactions, reaction)
+		}
+	}
+	return reactions, nil
+}
+
+func parseTimestamp(value string, fallback time.Time) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return fallback
+}
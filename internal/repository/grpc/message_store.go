@@ -0,0 +1,31 @@
+package grpc
+
+// messageStore keeps per-message state that the chat backend cannot persist.
+// It holds at most max messages, forgetting the ones it learned about first,
+// so memory stays bounded and only the most recent messages keep their state.
+// Zero means unbounded. It is not safe for concurrent use.
+type messageStore[V any] struct {
+	values map[uint32]V
+	order  []uint32
+	max    int
+}
+
+func newMessageStore[V any](max int) *messageStore[V] {
+	return &messageStore[V]{values: make(map[uint32]V), max: max}
+}
+
+func (s *messageStore[V]) get(messageId uint32) (V, bool) {
+	value, ok := s.values[messageId]
+	return value, ok
+}
+
+func (s *messageStore[V]) set(messageId uint32, value V) {
+	if _, ok := s.values[messageId]; !ok {
+		if s.max > 0 && len(s.values) >= s.max {
+			delete(s.values, s.order[0])
+			s.order = s.order[1:]
+		}
+		s.order = append(s.order, messageId)
+	}
+	s.values[messageId] = value
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"sync"
+	"time"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/repository"
+)
+
+const ticketSweepInterval = time.Second
+
+type ticketRepository struct {
+	tickets   map[string]entity.Ticket
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewTicketRepository() repository.TicketRepository {
+	return &ticketRepository{
+		tickets: make(map[string]entity.Ticket),
+	}
+}
+
+func (r *ticketRepository) Save(ticket entity.Ticket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep()
+	r.tickets[ticket.ID] = ticket
+	return nil
+}
+
+func (r *ticketRepository) Consume(ticketId string) (entity.Ticket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ticket, ok := r.tickets[ticketId]
+	if !ok {
+		return ticket, e.NotFound("Ticket not found")
+	}
+
+	delete(r.tickets, ticketId)
+	return ticket, nil
+}
+
+// sweep drops tickets that expired without being redeemed. Callers hold mu.
+func (r *ticketRepository) sweep() {
+	now := time.Now()
+	if now.Sub(r.lastSweep) < ticketSweepInterval {
+		return
+	}
+
+	for id, ticket := range r.tickets {
+		if now.After(ticket.ExpiresAt) {
+			delete(r.tickets, id)
+		}
+	}
+	r.lastSweep = now
+}
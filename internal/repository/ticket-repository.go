@@ -0,0 +1,9 @@
+package repository
+
+import "websocket-service/internal/entity"
+
+type TicketRepository interface {
+	Save(ticket entity.Ticket) error
+	// Consume returns the ticket and removes it, so it can only be redeemed once.
+	Consume(ticketId string) (entity.Ticket, error)
+}
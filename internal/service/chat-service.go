@@ -1,6 +1,9 @@
 package service
 
 import (
+	"fmt"
+	"unicode/utf8"
+	"websocket-service/internal/entity"
 	e "websocket-service/internal/exception"
 	"websocket-service/internal/model"
 	"websocket-service/internal/repository"
@@ -8,47 +11,182 @@ import (
 )
 
 type ChatService interface {
-	SendMessage(conversationId int, senderId int, content string) error
+	SendMessage(conversationId int, senderId int, content string, parentId uint32) (entity.Message, error)
 	GetConversation(conversationId int) ([]uint32, error)
-	ProcessMessage(userId int, request model.MessageRequest) ([]uint32, error)
+	ProcessMessage(userId int, request model.MessageRequest) (entity.Message, []uint32, error)
+	GetThread(userId int, request model.ThreadRequest) ([]entity.Message, error)
 }
 
 type chatService struct {
 	repo repository.ChatRepository
+	// threadScoped delivers replies to the thread's participants only.
+	threadScoped bool
+	// userLimiter bounds what a user sends across all their connections,
+	// conversationLimiter what all participants send to a conversation.
+	userLimiter         *utils.RateLimiter
+	conversationLimiter *utils.RateLimiter
+	maxMessageLength    int
 }
 
-func NewChatService(repo repository.ChatRepository) ChatService {
-	return &chatService{repo: repo}
+func NewChatService(repo repository.ChatRepository, threadScoped bool, userLimiter *utils.RateLimiter, conversationLimiter *utils.RateLimiter, maxMessageLength int) ChatService {
+	return &chatService{
+		repo:                repo,
+		threadScoped:        threadScoped,
+		userLimiter:         userLimiter,
+		conversationLimiter: conversationLimiter,
+		maxMessageLength:    maxMessageLength,
+	}
 }
 
-func (s *chatService) ProcessMessage(userId int, request model.MessageRequest) ([]uint32, error) {
+func (s *chatService) ProcessMessage(userId int, request model.MessageRequest) (entity.Message, []uint32, error) {
 	err := utils.Validate(request)
 	if err != nil {
-		return []uint32{}, e.Validation(err)
+		return entity.Message{}, []uint32{}, e.Validation(err)
+	}
+	if err := validateMessageLength(request.Message, s.maxMessageLength); err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	// Checked before anything reaches the backend.
+	if retryAfter, ok := s.userLimiter.Allow(userId); !ok {
+		return entity.Message{}, []uint32{}, e.RateLimited("You are sending messages too fast", retryAfter)
+	}
+
+	userIds, err := s.GetConversation(request.ConversationId)
+	if err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	if !isParticipant(userIds, userId) {
+		return entity.Message{}, []uint32{}, e.Forbidden("You are not a participant of this conversation")
+	}
+
+	if retryAfter, ok := s.conversationLimiter.Allow(request.ConversationId); !ok {
+		return entity.Message{}, []uint32{}, e.RateLimited("Too many messages are being sent to this conversation", retryAfter)
+	}
+
+	var thread []entity.Message
+	if request.ParentId != 0 {
+		request.ParentId, thread, err = s.resolveThread(request.ConversationId, request.ParentId)
+		if err != nil {
+			return entity.Message{}, []uint32{}, err
+		}
+	}
+
+	message, err := s.SendMessage(request.ConversationId, userId, request.Message, request.ParentId)
+	if err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	if s.threadScoped && request.ParentId != 0 {
+		userIds = threadParticipants(userIds, append(thread, message))
 	}
 
-	err = s.SendMessage(request.ConversationId, userId, request.Message)
+	return message, userIds, nil
+
+}
+
+func (s *chatService) GetThread(userId int, request model.ThreadRequest) ([]entity.Message, error) {
+	err := utils.Validate(request)
 	if err != nil {
-		return []uint32{}, err
+		return nil, e.Validation(err)
 	}
 
 	userIds, err := s.GetConversation(request.ConversationId)
 	if err != nil {
-		return []uint32{}, err
+		return nil, err
+	}
+	if !isParticipant(userIds, userId) {
+		return nil, e.Forbidden("You are not a participant of this conversation")
 	}
 
-	return userIds, nil
+	replies, err := s.repo.GetThread(request.ConversationId, request.ParentId)
+	if err != nil {
+		return nil, err
+	}
 
+	visible := make([]entity.Message, 0, len(replies))
+	for _, reply := range replies {
+		if !reply.IsDeleted() {
+			visible = append(visible, reply)
+		}
+	}
+	return visible, nil
 }
 
-func (s *chatService) SendMessage(conversationId int, senderId int, content string) error {
-	err := s.repo.SendMessage(conversationId, senderId, content)
+// resolveThread returns the root of the thread a reply to parentId belongs
+// to, along with the root and its replies. Threads are one level deep, so a
+// reply to a reply joins the root's thread.
+func (s *chatService) resolveThread(conversationId int, parentId uint32) (uint32, []entity.Message, error) {
+	messages, err := s.repo.GetMessages(conversationId)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+
+	rootId := uint32(0)
+	for _, message := range messages {
+		if message.ID == parentId && !message.IsDeleted() {
+			rootId = message.ID
+			if message.ParentID != 0 {
+				rootId = message.ParentID
+			}
+			break
+		}
+	}
+	if rootId == 0 {
+		return 0, nil, e.NotFound(fmt.Sprintf("Message %d not found", parentId))
+	}
+
+	var thread []entity.Message
+	for _, message := range messages {
+		if message.ID == rootId || message.ParentID == rootId {
+			thread = append(thread, message)
+		}
+	}
+	return rootId, thread, nil
+}
+
+// threadParticipants narrows the conversation participants down to those who
+// wrote in the thread.
+func threadParticipants(userIds []uint32, thread []entity.Message) []uint32 {
+	var participants []uint32
+	for _, id := range userIds {
+		for _, message := range thread {
+			if uint32(message.SenderID) == id {
+				participants = append(participants, id)
+				break
+			}
+		}
+	}
+	return participants
+}
+
+// validateMessageLength rejects messages of more than max characters, max
+// being 0 for no limit.
+func validateMessageLength(message string, max int) error {
+	if max > 0 && utf8.RuneCountInString(message) > max {
+		return e.Validation(fmt.Errorf("message is longer than %d characters", max))
 	}
 	return nil
 }
 
+func isParticipant(userIds []uint32, userId int) bool {
+	for _, id := range userIds {
+		if id == uint32(userId) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *chatService) SendMessage(conversationId int, senderId int, content string, parentId uint32) (entity.Message, error) {
+	message, err := s.repo.SendMessage(conversationId, senderId, content, parentId)
+	if err != nil {
+		return entity.Message{}, err
+	}
+	return message, nil
+}
+
 func (s *chatService) GetConversation(conversationId int) ([]uint32, error) {
 	messages, err := s.repo.GetConversation(conversationId)
 	if err != nil {
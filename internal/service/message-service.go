@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/repository"
+	"websocket-service/internal/utils"
+)
+
+type MessageService interface {
+	EditMessage(userId int, roles []string, request model.EditMessageRequest) (entity.Message, []uint32, error)
+	DeleteMessage(userId int, roles []string, request model.DeleteMessageRequest) (entity.Message, []uint32, error)
+}
+
+type messageService struct {
+	repo             repository.ChatRepository
+	moderatorRole    string
+	maxMessageLength int
+}
+
+func NewMessageService(repo repository.ChatRepository, moderatorRole string, maxMessageLength int) MessageService {
+	return &messageService{
+		repo:             repo,
+		moderatorRole:    moderatorRole,
+		maxMessageLength: maxMessageLength,
+	}
+}
+
+func (s *messageService) EditMessage(userId int, roles []string, request model.EditMessageRequest) (entity.Message, []uint32, error) {
+	err := utils.Validate(request)
+	if err != nil {
+		return entity.Message{}, []uint32{}, e.Validation(err)
+	}
+	if err := validateMessageLength(request.Message, s.maxMessageLength); err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	message, participants, err := s.authorize(userId, roles, request.ConversationId, request.MessageId)
+	if err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	message.Content = request.Message
+	message.EditedAt = time.Now()
+	if err := s.repo.UpdateMessage(message); err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	return message, participants, nil
+}
+
+func (s *messageService) DeleteMessage(userId int, roles []string, request model.DeleteMessageRequest) (entity.Message, []uint32, error) {
+	err := utils.Validate(request)
+	if err != nil {
+		return entity.Message{}, []uint32{}, e.Validation(err)
+	}
+
+	message, participants, err := s.authorize(userId, roles, request.ConversationId, request.MessageId)
+	if err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	message.Content = ""
+	message.DeletedAt = time.Now()
+	if err := s.repo.UpdateMessage(message); err != nil {
+		return entity.Message{}, []uint32{}, err
+	}
+
+	return message, participants, nil
+}
+
+// authorize looks up the message and checks that the user sent it or is a
+// moderator. Deleted messages can no longer be changed.
+func (s *messageService) authorize(userId int, roles []string, conversationId int, messageId uint32) (entity.Message, []uint32, error) {
+	participants, err := s.repo.GetConversation(conversationId)
+	if err != nil {
+		return entity.Message{}, nil, err
+	}
+
+	moderator := s.isModerator(roles)
+	if !moderator && !isParticipant(participants, userId) {
+		return entity.Message{}, nil, e.Forbidden("You are not a participant of this conversation")
+	}
+
+	messages, err := s.repo.GetMessages(conversationId)
+	if err != nil {
+		return entity.Message{}, nil, err
+	}
+	for _, message := range messages {
+		if message.ID != messageId {
+			continue
+		}
+		if message.IsDeleted() {
+			break
+		}
+		if message.SenderID != userId && !moderator {
+			return entity.Message{}, nil, e.Forbidden("Only the sender or a moderator can change this message")
+		}
+		return message, participants, nil
+	}
+
+	return entity.Message{}, nil, e.NotFound(fmt.Sprintf("Message %d not found", messageId))
+}
+
+func (s *messageService) isModerator(roles []string) bool {
+	if s.moderatorRole == "" {
+		return false
+	}
+	for _, role := range roles {
+		if role == s.moderatorRole {
+			return true
+		}
+	}
+	return false
+}
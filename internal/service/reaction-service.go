@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/repository"
+	"websocket-service/internal/utils"
+)
+
+// ReactionNotifier pushes the new reaction totals of a message to the conversation.
+type ReactionNotifier func(recipients []uint32, reaction model.ReactionPayload)
+
+type ReactionService interface {
+	AddReaction(userId int, request model.ReactionRequest) error
+	RemoveReaction(userId int, request model.ReactionRequest) error
+	ListReactions(userId int, request model.ReactionListRequest) ([]model.ReactionPayload, error)
+}
+
+type reactionService struct {
+	repo   repository.ChatRepository
+	notify ReactionNotifier
+}
+
+func NewReactionService(repo repository.ChatRepository, notify ReactionNotifier) ReactionService {
+	return &reactionService{
+		repo:   repo,
+		notify: notify,
+	}
+}
+
+func (s *reactionService) AddReaction(userId int, request model.ReactionRequest) error {
+	err := utils.Validate(request)
+	if err != nil {
+		return e.Validation(err)
+	}
+
+	participants, err := s.checkMessages(userId, request.ConversationId, []uint32{request.MessageId})
+	if err != nil {
+		return err
+	}
+
+	added, err := s.repo.SaveReaction(entity.Reaction{
+		MessageID:      request.MessageId,
+		UserID:         userId,
+		Emoji:          request.Emoji,
+		ConversationID: request.ConversationId,
+		CreatedAt:      time.Now(),
+	})
+	if err != nil || !added {
+		return err
+	}
+
+	return s.publish(participants, userId, request, model.ReactionActionAdd)
+}
+
+func (s *reactionService) RemoveReaction(userId int, request model.ReactionRequest) error {
+	err := utils.Validate(request)
+	if err != nil {
+		return e.Validation(err)
+	}
+
+	participants, err := s.checkMessages(userId, request.ConversationId, []uint32{request.MessageId})
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.repo.DeleteReaction(request.MessageId, userId, request.Emoji)
+	if err != nil || !removed {
+		return err
+	}
+
+	return s.publish(participants, userId, request, model.ReactionActionRemove)
+}
+
+func (s *reactionService) ListReactions(userId int, request model.ReactionListRequest) ([]model.ReactionPayload, error) {
+	err := utils.Validate(request)
+	if err != nil {
+		return nil, e.Validation(err)
+	}
+
+	if _, err = s.checkMessages(userId, request.ConversationId, request.MessageIds); err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.repo.GetReactions(request.MessageIds)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]model.ReactionPayload, 0, len(request.MessageIds))
+	for _, messageId := range request.MessageIds {
+		payloads = append(payloads, model.ReactionPayload{
+			ConversationId: request.ConversationId,
+			MessageId:      messageId,
+			Counts:         countReactions(reactions, messageId),
+		})
+	}
+	return payloads, nil
+}
+
+// checkMessages makes sure the user takes part in the conversation and that
+// the messages exist in it, returning the participants.
+func (s *reactionService) checkMessages(userId int, conversationId int, messageIds []uint32) ([]uint32, error) {
+	participants, err := s.repo.GetConversation(conversationId)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant(participants, userId) {
+		return nil, e.Forbidden("You are not a participant of this conversation")
+	}
+
+	messages, err := s.repo.GetMessages(conversationId)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[uint32]bool, len(messages))
+	for _, message := range messages {
+		existing[message.ID] = !message.IsDeleted()
+	}
+	for _, messageId := range messageIds {
+		if !existing[messageId] {
+			return nil, e.NotFound(fmt.Sprintf("Message %d not found", messageId))
+		}
+	}
+	return participants, nil
+}
+
+func (s *reactionService) publish(participants []uint32, userId int, request model.ReactionRequest, action string) error {
+	reactions, err := s.repo.GetReactions([]uint32{request.MessageId})
+	if err != nil {
+		return err
+	}
+
+	s.notify(participants, model.ReactionPayload{
+		ConversationId: request.ConversationId,
+		MessageId:      request.MessageId,
+		UserId:         userId,
+		Emoji:          request.Emoji,
+		Action:         action,
+		Counts:         countReactions(reactions, request.MessageId),
+	})
+	return nil
+}
+
+// countReactions tallies the reactions of one message per emoji.
+func countReactions(reactions []entity.Reaction, messageId uint32) map[string]int {
+	counts := make(map[string]int)
+	for _, reaction := range reactions {
+		if reaction.MessageID == messageId {
+			counts[reaction.Emoji]++
+		}
+	}
+	return counts
+}
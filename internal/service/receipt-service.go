@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/repository"
+	"websocket-service/internal/utils"
+)
+
+// ReceiptNotifier tells the original sender how far their message has reached.
+type ReceiptNotifier func(senderId uint32, receipt model.ReceiptPayload)
+
+type ReceiptService interface {
+	MarkMessages(userId int, request model.ReceiptRequest, status string) error
+}
+
+type receiptService struct {
+	repo   repository.ChatRepository
+	notify ReceiptNotifier
+}
+
+func NewReceiptService(repo repository.ChatRepository, notify ReceiptNotifier) ReceiptService {
+	return &receiptService{
+		repo:   repo,
+		notify: notify,
+	}
+}
+
+func (s *receiptService) MarkMessages(userId int, request model.ReceiptRequest, status string) error {
+	err := utils.Validate(request)
+	if err != nil {
+		return e.Validation(err)
+	}
+
+	participants, err := s.repo.GetConversation(request.ConversationId)
+	if err != nil {
+		return err
+	}
+	if !isParticipant(participants, userId) {
+		return e.Forbidden("You are not a participant of this conversation")
+	}
+
+	messages, err := s.repo.GetMessages(request.ConversationId)
+	if err != nil {
+		return err
+	}
+	senders := make(map[uint32]int, len(messages))
+	for _, message := range messages {
+		senders[message.ID] = message.SenderID
+	}
+
+	now := time.Now()
+	var receipts []entity.Receipt
+	for _, messageId := range request.MessageIds {
+		senderId, ok := senders[messageId]
+		if !ok {
+			return e.NotFound(fmt.Sprintf("Message %d not found", messageId))
+		}
+		// Senders do not acknowledge their own messages.
+		if senderId == userId {
+			continue
+		}
+
+		receipts = append(receipts, entity.Receipt{
+			MessageID:      messageId,
+			UserID:         userId,
+			ConversationID: request.ConversationId,
+			Status:         status,
+			UpdatedAt:      now,
+		})
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	if err = s.repo.SaveReceipts(receipts); err != nil {
+		return err
+	}
+
+	stored, err := s.repo.GetReceipts(request.MessageIds)
+	if err != nil {
+		return err
+	}
+
+	for _, receipt := range receipts {
+		payload := model.ReceiptPayload{
+			ConversationId: receipt.ConversationID,
+			MessageId:      receipt.MessageID,
+			UserId:         receipt.UserID,
+			Status:         receipt.Status,
+			RecipientCount: len(participants) - 1,
+		}
+		for _, other := range stored {
+			if other.MessageID != receipt.MessageID {
+				continue
+			}
+			// Read implies delivered.
+			payload.DeliveredCount++
+			if other.Status == entity.ReceiptStatusRead {
+				payload.ReadCount++
+			}
+		}
+
+		s.notify(uint32(senders[receipt.MessageID]), payload)
+	}
+	return nil
+}
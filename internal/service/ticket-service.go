@@ -0,0 +1,77 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/model"
+	"websocket-service/internal/repository"
+)
+
+type TicketService interface {
+	Issue(userId int, token string, clientIP string) (model.TicketResponse, error)
+	Redeem(ticketId string, clientIP string) (string, error)
+}
+
+type ticketService struct {
+	repo   repository.TicketRepository
+	ttl    time.Duration
+	bindIP bool
+}
+
+func NewTicketService(repo repository.TicketRepository, ttl time.Duration, bindIP bool) TicketService {
+	return &ticketService{
+		repo:   repo,
+		ttl:    ttl,
+		bindIP: bindIP,
+	}
+}
+
+func (s *ticketService) Issue(userId int, token string, clientIP string) (model.TicketResponse, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return model.TicketResponse{}, e.Internal(err)
+	}
+
+	ticket := entity.Ticket{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		UserID:    userId,
+		Token:     token,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if s.bindIP {
+		ticket.ClientIP = clientIP
+	}
+
+	if err := s.repo.Save(ticket); err != nil {
+		return model.TicketResponse{}, err
+	}
+
+	return model.TicketResponse{
+		Ticket:    ticket.ID,
+		ExpiresIn: int(s.ttl / time.Second),
+		ExpiresAt: ticket.ExpiresAt,
+	}, nil
+}
+
+// Redeem consumes the ticket and returns the token it was issued for, which the
+// caller verifies again so a token revoked or expired meanwhile is still refused.
+func (s *ticketService) Redeem(ticketId string, clientIP string) (string, error) {
+	ticket, err := s.repo.Consume(ticketId)
+	if err != nil {
+		return "", e.Unauthorized(errors.New("invalid ticket"))
+	}
+
+	if time.Now().After(ticket.ExpiresAt) {
+		return "", e.Unauthorized(errors.New("ticket expired"))
+	}
+
+	if ticket.ClientIP != "" && ticket.ClientIP != clientIP {
+		return "", e.Unauthorized(errors.New("ticket issued to another address"))
+	}
+
+	return ticket.Token, nil
+}
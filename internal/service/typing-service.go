@@ -0,0 +1,123 @@
+package service
+
+import (
+	"sync"
+	"time"
+	e "websocket-service/internal/exception"
+	"websocket-service/internal/repository"
+)
+
+// TypingNotifier fans a typing state change out to the given recipients.
+type TypingNotifier func(recipients []uint32, conversationId int, userId int, typing bool)
+
+type TypingService interface {
+	StartTyping(userId int, conversationId int) error
+	StopTyping(userId int, conversationId int)
+}
+
+type typingKey struct {
+	userId         int
+	conversationId int
+}
+
+type typingState struct {
+	recipients   []uint32
+	lastNotified time.Time
+	timer        *time.Timer
+}
+
+// typingService keeps typing state in memory only; nothing reaches the chat
+// backend. Repeated starts are relayed at most once per debounce interval, and
+// a user who stops sending them is reported as stopped after timeout.
+type typingService struct {
+	repo     repository.ChatRepository
+	notify   TypingNotifier
+	debounce time.Duration
+	timeout  time.Duration
+	states   map[typingKey]*typingState
+	mu       sync.Mutex
+}
+
+func NewTypingService(repo repository.ChatRepository, notify TypingNotifier, debounce time.Duration, timeout time.Duration) TypingService {
+	return &typingService{
+		repo:     repo,
+		notify:   notify,
+		debounce: debounce,
+		timeout:  timeout,
+		states:   make(map[typingKey]*typingState),
+	}
+}
+
+func (s *typingService) StartTyping(userId int, conversationId int) error {
+	participants, err := s.repo.GetConversation(conversationId)
+	if err != nil {
+		return err
+	}
+	if !isParticipant(participants, userId) {
+		return e.Forbidden("You are not a participant of this conversation")
+	}
+
+	key := typingKey{userId: userId, conversationId: conversationId}
+	now := time.Now()
+
+	s.mu.Lock()
+	state, ok := s.states[key]
+	if !ok {
+		state = &typingState{recipients: otherParticipants(participants, userId)}
+		s.states[key] = state
+		state.timer = time.AfterFunc(s.timeout, func() { s.expire(key, state) })
+	} else {
+		state.timer.Reset(s.timeout)
+	}
+
+	debounced := now.Sub(state.lastNotified) < s.debounce
+	if !debounced {
+		state.lastNotified = now
+	}
+	recipients := state.recipients
+	s.mu.Unlock()
+
+	if !debounced {
+		s.notify(recipients, conversationId, userId, true)
+	}
+	return nil
+}
+
+func (s *typingService) StopTyping(userId int, conversationId int) {
+	key := typingKey{userId: userId, conversationId: conversationId}
+
+	s.mu.Lock()
+	state, ok := s.states[key]
+	if ok {
+		state.timer.Stop()
+		delete(s.states, key)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.notify(state.recipients, conversationId, userId, false)
+	}
+}
+
+func (s *typingService) expire(key typingKey, state *typingState) {
+	s.mu.Lock()
+	current, ok := s.states[key]
+	if ok && current == state {
+		delete(s.states, key)
+	}
+	s.mu.Unlock()
+
+	if ok && current == state {
+		s.notify(state.recipients, key.conversationId, key.userId, false)
+	}
+}
+
+func otherParticipants(participants []uint32, userId int) []uint32 {
+	recipients := make([]uint32, 0, len(participants))
+	for _, id := range participants {
+		if id != uint32(userId) {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/klauspost/compress/flate"
+)
+
+// CompressionStats totals the messages sent with permessage-deflate. Only one
+// in compressionSampleInterval messages is compressed a second time to measure
+// it, so CompressedBytes is estimated from the Ratio of that sample.
+type CompressionStats struct {
+	Messages          uint64  `json:"messages"`
+	SampledMessages   uint64  `json:"sampled_messages"`
+	UncompressedBytes uint64  `json:"uncompressed_bytes"`
+	CompressedBytes   uint64  `json:"compressed_bytes"`
+	Ratio             float64 `json:"ratio"`
+}
+
+// compressionSampleInterval keeps the metric from doubling compression work.
+const compressionSampleInterval = 16
+
+type compressionMetrics struct {
+	messages          atomic.Uint64
+	uncompressedBytes atomic.Uint64
+
+	sampledMessages          atomic.Uint64
+	sampledUncompressedBytes atomic.Uint64
+	sampledCompressedBytes   atomic.Uint64
+
+	// candidates counts the messages that could have been sampled. Only Run
+	// touches it.
+	candidates uint64
+}
+
+// sample reports whether the next compressed message should be measured.
+func (m *compressionMetrics) sample() bool {
+	m.candidates++
+	return m.candidates%compressionSampleInterval == 1
+}
+
+// record adds a compressed message, with its compressed size when it was
+// sampled and zero otherwise.
+func (m *compressionMetrics) record(uncompressed, compressed int) {
+	m.messages.Add(1)
+	m.uncompressedBytes.Add(uint64(uncompressed))
+	if compressed > 0 {
+		m.sampledMessages.Add(1)
+		m.sampledUncompressedBytes.Add(uint64(uncompressed))
+		m.sampledCompressedBytes.Add(uint64(compressed))
+	}
+}
+
+// countingWriter discards what it is given, only counting the bytes.
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// deflater measures how large messages are once compressed. Like the
+// connections it compresses every message on its own, without context
+// takeover, so the sizes match what goes on the wire.
+type deflater struct {
+	level int
+	pool  sync.Pool
+}
+
+func newDeflater(level int) *deflater {
+	return &deflater{level: level}
+}
+
+func (d *deflater) compressedSize(data []byte) int {
+	var size countingWriter
+	fw, _ := d.pool.Get().(*flate.Writer)
+	if fw == nil {
+		var err error
+		if fw, err = flate.NewWriter(&size, d.level); err != nil {
+			return len(data)
+		}
+	} else {
+		fw.Reset(&size)
+	}
+	defer d.pool.Put(fw)
+
+	fw.Write(data)
+	fw.Flush()
+	// permessage-deflate drops the empty block trailer the flush ends with.
+	return int(size) - 4
+}
+
+// negotiatedCompression reports whether the client offered permessage-deflate,
+// which the upgrader accepts whenever compression is enabled. The headers are
+// keyed the way fasthttp normalizes them.
+func negotiatedCompression(c *websocket.Conn) bool {
+	return strings.Contains(strings.ToLower(c.Headers("Sec-Websocket-Extensions")), "permessage-deflate")
+}
+
+// CompressionStats returns the compression totals so far.
+func (manager *WebSocketManager) CompressionStats() CompressionStats {
+	stats := CompressionStats{
+		Messages:          manager.compression.messages.Load(),
+		SampledMessages:   manager.compression.sampledMessages.Load(),
+		UncompressedBytes: manager.compression.uncompressedBytes.Load(),
+	}
+	if sampled := manager.compression.sampledUncompressedBytes.Load(); sampled > 0 {
+		stats.Ratio = float64(manager.compression.sampledCompressedBytes.Load()) / float64(sampled)
+		stats.CompressedBytes = uint64(float64(stats.UncompressedBytes) * stats.Ratio)
+	}
+	return stats
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+func (manager *WebSocketManager) ping(c *websocket.Conn) error {
+	return c.WriteControl(websocket.PingMessage, nil, manager.writeDeadline())
+}
+
+// extendReadDeadline gives the client another PongWait to show it is alive,
+// by answering a ping or sending anything at all.
+func (manager *WebSocketManager) extendReadDeadline(c *websocket.Conn) {
+	if manager.config.PongWait > 0 {
+		c.SetReadDeadline(time.Now().Add(manager.config.PongWait))
+	}
+}
+
+// writeDeadline bounds a write starting now, the zero time meaning no bound.
+func (manager *WebSocketManager) writeDeadline() time.Time {
+	if manager.config.WriteTimeout > 0 {
+		return time.Now().Add(manager.config.WriteTimeout)
+	}
+	return time.Time{}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"log"
+	"websocket-service/internal/model"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+var errMessageTooBig = errors.New("message too big")
+
+// readMessage reads the next message, failing with errMessageTooBig past the
+// read limit without reading the rest. The limit applies to the inflated
+// message, so compression cannot smuggle a larger one in. Conn.SetReadLimit is
+// not used as it closes the socket without saying why.
+func (manager *WebSocketManager) readMessage(c *websocket.Conn) ([]byte, error) {
+	_, reader, err := c.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	if manager.config.ReadLimit <= 0 {
+		return io.ReadAll(reader)
+	}
+
+	message, err := io.ReadAll(io.LimitReader(reader, manager.config.ReadLimit+1))
+	if err == nil && int64(len(message)) > manager.config.ReadLimit {
+		return nil, errMessageTooBig
+	}
+	return message, err
+}
+
+// process hands the frames read off the connection to callback in order.
+// Frames wait in a queue of MaxInflightFrames; once it is full, reading stops
+// until the callback catches up, pushing back on the client through TCP.
+func (manager *WebSocketManager) process(connInfo *WebSocketConnInfo, inbound <-chan model.FrameRequest, callback func(connInfo *WebSocketConnInfo, frame model.FrameRequest)) {
+	for frame := range inbound {
+		log.Printf("Received %s frame from user %d", frame.Type, connInfo.UserId)
+		callback(connInfo, frame)
+	}
+}
@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// KeySet holds the public keys of a JWKS document indexed by kid. The document is
+// re-read whenever the file changes; a broken update keeps the previous keys.
+type KeySet struct {
+	path    string
+	keys    map[string]*jsonWebKey
+	mu      sync.RWMutex
+	watcher *fsnotify.Watcher
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	publicKey interface{}
+}
+
+var curveByAlg = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+func NewKeySet(path string) (*KeySet, error) {
+	keySet := &KeySet{path: path}
+	if err := keySet.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory rather than the file, so atomic replaces (rename, or a
+	// Kubernetes ConfigMap symlink swap) are picked up as well.
+	if err = watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	keySet.watcher = watcher
+
+	go keySet.watch()
+	return keySet, nil
+}
+
+// Key returns the verification key for kid, checking it may be used with alg.
+func (keySet *KeySet) Key(kid string, alg string) (interface{}, error) {
+	keySet.mu.RLock()
+	defer keySet.mu.RUnlock()
+
+	key, ok := keySet.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.Alg != "" && key.Alg != alg {
+		return nil, fmt.Errorf("key %q is not usable with %s", kid, alg)
+	}
+
+	switch key.publicKey.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+			return nil, fmt.Errorf("key %q is not usable with %s", kid, alg)
+		}
+	case *ecdsa.PublicKey:
+		if curveByAlg[alg] != key.Crv {
+			return nil, fmt.Errorf("key %q is not usable with %s", kid, alg)
+		}
+	}
+
+	return key.publicKey, nil
+}
+
+func (keySet *KeySet) Close() error {
+	return keySet.watcher.Close()
+}
+
+func (keySet *KeySet) watch() {
+	name := filepath.Clean(keySet.path)
+	for {
+		select {
+		case event, ok := <-keySet.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != name && !event.Has(fsnotify.Create) {
+				continue
+			}
+			if err := keySet.load(); err != nil {
+				log.Printf("Failed to reload JWKS from %s: %v", keySet.path, err)
+				continue
+			}
+			log.Printf("Reloaded JWKS from %s", keySet.path)
+		case err, ok := <-keySet.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("JWKS watcher error: %v", err)
+		}
+	}
+}
+
+func (keySet *KeySet) load() error {
+	data, err := os.ReadFile(keySet.path)
+	if err != nil {
+		return err
+	}
+
+	var document struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*jsonWebKey)
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		key.publicKey, err = key.parse()
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.Kid, err)
+		}
+		keys[key.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("no signing keys found")
+	}
+
+	keySet.mu.Lock()
+	keySet.keys = keys
+	keySet.mu.Unlock()
+	return nil
+}
+
+func (key *jsonWebKey) parse() (interface{}, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -1,15 +1,160 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"time"
 )
 
 type Claims struct {
 	UserID string `json:"user_id"`
+	// Audience shadows StandardClaims.Audience, which cannot hold the array form.
+	Audience ClaimStrings `json:"aud,omitempty"`
+	Roles    ClaimStrings `json:"roles,omitempty"`
 	jwt.StandardClaims
 }
 
+// ClaimStrings accepts a claim encoded either as a single string or as an array.
+type ClaimStrings []string
+
+func (s *ClaimStrings) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = ClaimStrings{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*s = multiple
+	return nil
+}
+
+func (s ClaimStrings) Contains(value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type TokenVerifierConfig struct {
+	// Algorithms lists the accepted signing algorithms, e.g. HS256, RS256, ES256.
+	Algorithms []string
+	// Secret is the shared key for HS* tokens.
+	Secret string
+	// JWKSFile is the path of the JWKS document holding the RS*/ES* public keys.
+	JWKSFile string
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+type TokenVerifier struct {
+	config TokenVerifierConfig
+	parser *jwt.Parser
+	keys   *KeySet
+}
+
+func NewTokenVerifier(config TokenVerifierConfig) (*TokenVerifier, error) {
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{jwt.SigningMethodHS256.Alg()}
+	}
+
+	verifier := &TokenVerifier{
+		config: config,
+		parser: &jwt.Parser{
+			ValidMethods:         config.Algorithms,
+			SkipClaimsValidation: true,
+		},
+	}
+
+	for _, alg := range config.Algorithms {
+		switch jwt.GetSigningMethod(alg).(type) {
+		case *jwt.SigningMethodHMAC:
+			if config.Secret == "" {
+				return nil, fmt.Errorf("%s requires a JWT secret", alg)
+			}
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+			if config.JWKSFile == "" {
+				return nil, fmt.Errorf("%s requires a JWKS file", alg)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+	}
+
+	if config.JWKSFile != "" {
+		keys, err := NewKeySet(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWKS: %w", err)
+		}
+		verifier.keys = keys
+	}
+
+	return verifier, nil
+}
+
+func (verifier *TokenVerifier) Parse(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := verifier.parser.ParseWithClaims(tokenStr, claims, verifier.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	if err = verifier.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (verifier *TokenVerifier) Close() error {
+	if verifier.keys == nil {
+		return nil
+	}
+	return verifier.keys.Close()
+}
+
+func (verifier *TokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return []byte(verifier.config.Secret), nil
+	default:
+		kid, _ := token.Header["kid"].(string)
+		return verifier.keys.Key(kid, token.Method.Alg())
+	}
+}
+
+func (verifier *TokenVerifier) validateClaims(claims *Claims) error {
+	now := time.Now().Unix()
+	leeway := int64(verifier.config.Leeway / time.Second)
+
+	if claims.ExpiresAt != 0 && now > claims.ExpiresAt+leeway {
+		return errors.New("token is expired")
+	}
+	if claims.NotBefore != 0 && now+leeway < claims.NotBefore {
+		return errors.New("token is not valid yet")
+	}
+	if claims.IssuedAt != 0 && now+leeway < claims.IssuedAt {
+		return errors.New("token used before issued")
+	}
+	if verifier.config.Issuer != "" && claims.Issuer != verifier.config.Issuer {
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if verifier.config.Audience != "" && !claims.Audience.Contains(verifier.config.Audience) {
+		return errors.New("token is not meant for this audience")
+	}
+	return nil
+}
+
 func GenerateToken(userID string, jwtKey string) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const testSecret = "secret"
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": encodeBigInt(key.N), "e": encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "use": "sig", "crv": "P-256",
+		"x": encodeBigInt(key.X), "y": encodeBigInt(key.Y),
+	}
+}
+
+// writeJWKS replaces the document atomically, as deployments do.
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, data)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID: "1",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+}
+
+func TestNewTokenVerifierRejectsIncompleteConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config TokenVerifierConfig
+	}{
+		{"HMAC without secret", TokenVerifierConfig{Algorithms: []string{"HS256"}}},
+		{"RSA without JWKS", TokenVerifierConfig{Algorithms: []string{"RS256"}}},
+		{"ECDSA without JWKS", TokenVerifierConfig{Algorithms: []string{"ES256"}, Secret: testSecret}},
+		{"unknown algorithm", TokenVerifierConfig{Algorithms: []string{"XX256"}, Secret: testSecret}},
+		{"none", TokenVerifierConfig{Algorithms: []string{"none"}, Secret: testSecret}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewTokenVerifier(test.config); err == nil {
+				t.Fatal("verifier created from an incomplete config")
+			}
+		})
+	}
+}
+
+func TestTokenVerifierParse(t *testing.T) {
+	rsaKey, otherRSAKey, ecKey := newRSAKey(t), newRSAKey(t), newECKey(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey))
+
+	verifier, err := NewTokenVerifier(TokenVerifierConfig{
+		Algorithms: []string{"HS256", "RS256", "ES256"},
+		Secret:     testSecret,
+		JWKSFile:   jwksFile,
+		Issuer:     "auth",
+		Audience:   "chat",
+		Leeway:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer verifier.Close()
+
+	claims := func(modify func(claims *Claims)) *Claims {
+		claims := validClaims()
+		claims.Issuer = "auth"
+		claims.Audience = ClaimStrings{"chat"}
+		if modify != nil {
+			modify(claims)
+		}
+		return claims
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(nil)), true},
+		{"HS256 with wrong secret", signToken(t, jwt.SigningMethodHS256, "", []byte("other"), claims(nil)), false},
+		{"HS512 not allowed", signToken(t, jwt.SigningMethodHS512, "", []byte(testSecret), claims(nil)), false},
+		{"RS256 by kid", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)), true},
+		{"RS256 with unknown kid", signToken(t, jwt.SigningMethodRS256, "missing", rsaKey, claims(nil)), false},
+		{"RS256 without kid", signToken(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil)), false},
+		{"RS256 signed by another key", signToken(t, jwt.SigningMethodRS256, "rsa", otherRSAKey, claims(nil)), false},
+		{"RS256 naming the EC key", signToken(t, jwt.SigningMethodRS256, "ec", rsaKey, claims(nil)), false},
+		{"ES256 by kid", signToken(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)), true},
+		{"ES256 naming the RSA key", signToken(t, jwt.SigningMethodES256, "rsa", ecKey, claims(nil)), false},
+		{"alg none", signToken(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil)), false},
+		{"expired", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.ExpiresAt = now.Add(-time.Minute).Unix()
+		})), false},
+		{"expired within leeway", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.ExpiresAt = now.Add(-10 * time.Second).Unix()
+		})), true},
+		{"not valid yet", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.NotBefore = now.Add(time.Minute).Unix()
+		})), false},
+		{"issued in the future", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.IssuedAt = now.Add(time.Minute).Unix()
+		})), false},
+		{"wrong issuer", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.Issuer = "someone else"
+		})), false},
+		{"missing issuer", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.Issuer = ""
+		})), false},
+		{"wrong audience", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.Audience = ClaimStrings{"billing"}
+		})), false},
+		{"one of several audiences", signToken(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(func(c *Claims) {
+			c.Audience = ClaimStrings{"billing", "chat"}
+		})), true},
+		{"malformed", "not.a.token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := verifier.Parse(test.token)
+			if test.valid && err != nil {
+				t.Fatalf("valid token refused: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("invalid token accepted for user %q", parsed.UserID)
+			}
+			if test.valid && parsed.UserID != "1" {
+				t.Fatalf("got user %q, want 1", parsed.UserID)
+			}
+		})
+	}
+}
+
+func TestTokenVerifierReloadsJWKS(t *testing.T) {
+	oldKey, newKey := newRSAKey(t), newRSAKey(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, rsaJWK("old", oldKey))
+
+	verifier, err := NewTokenVerifier(TokenVerifierConfig{Algorithms: []string{"RS256"}, JWKSFile: jwksFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer verifier.Close()
+
+	oldToken := signToken(t, jwt.SigningMethodRS256, "old", oldKey, validClaims())
+	newToken := signToken(t, jwt.SigningMethodRS256, "new", newKey, validClaims())
+	if _, err := verifier.Parse(newToken); err == nil {
+		t.Fatal("token signed by a key not yet published was accepted")
+	}
+
+	writeJWKS(t, jwksFile, rsaJWK("new", newKey))
+	waitFor(t, "rotated key to be picked up", func() bool {
+		_, err := verifier.Parse(newToken)
+		return err == nil
+	})
+	if _, err := verifier.Parse(oldToken); err == nil {
+		t.Fatal("token signed by a retired key is still accepted")
+	}
+
+	// A broken document keeps the keys loaded before it.
+	writeFile(t, jwksFile, []byte("{not json"))
+	time.Sleep(200 * time.Millisecond)
+	if _, err := verifier.Parse(newToken); err != nil {
+		t.Fatalf("keys lost after a broken update: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConnectionLimitPolicy decides who gives way when a connection limit is
+// reached.
+type ConnectionLimitPolicy string
+
+const (
+	ConnectionLimitReject      ConnectionLimitPolicy = "reject"
+	ConnectionLimitEvictOldest ConnectionLimitPolicy = "evict_oldest"
+)
+
+func ParseConnectionLimitPolicy(value string) (ConnectionLimitPolicy, error) {
+	switch policy := ConnectionLimitPolicy(value); policy {
+	case ConnectionLimitReject, ConnectionLimitEvictOldest:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown connection limit policy %q", value)
+}
+
+// ConnectionLimits bounds the connections a registry holds. Zero means no
+// limit.
+type ConnectionLimits struct {
+	PerUser int
+	Total   int
+	Policy  ConnectionLimitPolicy
+}
+
+var (
+	ErrUserConnectionLimit = errors.New("too many connections for this user")
+	ErrConnectionLimit     = errors.New("too many connections to this server")
+)
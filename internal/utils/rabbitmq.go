@@ -102,6 +102,12 @@ func (r *RabbitMQ) ConsumeMessages(queueName, consumerName string, handler func(
 	return nil
 }
 
+// Cancel stops deliveries to the consumer. Deliveries already received are
+// still handled.
+func (r *RabbitMQ) Cancel(consumerName string) error {
+	return r.channel.Cancel(consumerName, false)
+}
+
 func (r *RabbitMQ) Close() {
 	r.channel.Close()
 	r.conn.Close()
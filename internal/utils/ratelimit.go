@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps a token bucket per key, refilled at rate tokens a second up
+// to burst. A nil RateLimiter allows everything.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[int]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns nil, allowing everything, when rate is not positive.
+// A burst below one is raised to one.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[int]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket. When it is empty, it reports how
+// long until the next token instead.
+func (limiter *RateLimiter) Allow(key int) (time.Duration, bool) {
+	if limiter == nil {
+		return 0, true
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, updated: now}
+		limiter.buckets[key] = bucket
+	}
+	bucket.tokens = limiter.refilled(bucket, now)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / limiter.rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+func (limiter *RateLimiter) refilled(bucket *tokenBucket, now time.Time) float64 {
+	tokens := bucket.tokens + now.Sub(bucket.updated).Seconds()*limiter.rate
+	if tokens > limiter.burst {
+		return limiter.burst
+	}
+	return tokens
+}
+
+// sweep forgets the buckets that have filled up again, which behave as new
+// ones, at most once per refill period.
+func (limiter *RateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep).Seconds() < limiter.burst/limiter.rate {
+		return
+	}
+	limiter.lastSweep = now
+	for key, bucket := range limiter.buckets {
+		if limiter.refilled(bucket, now) >= limiter.burst {
+			delete(limiter.buckets, key)
+		}
+	}
+}
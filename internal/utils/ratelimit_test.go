@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter returns a limiter whose clock only moves when advance is
+// called.
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, func(time.Duration)) {
+	limiter := NewRateLimiter(rate, burst)
+	now := time.Now()
+	limiter.lastSweep = now
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter, _ := newTestRateLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if _, ok := limiter.Allow(1); !ok {
+			t.Fatalf("frame %d of the burst refused", i+1)
+		}
+	}
+	if _, ok := limiter.Allow(1); ok {
+		t.Fatal("frame beyond the burst allowed")
+	}
+
+	// Buckets are per key.
+	if _, ok := limiter.Allow(2); !ok {
+		t.Fatal("another user was limited")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter, advance := newTestRateLimiter(2, 2)
+	limiter.Allow(1)
+	limiter.Allow(1)
+
+	advance(250 * time.Millisecond)
+	if _, ok := limiter.Allow(1); ok {
+		t.Fatal("allowed with half a token")
+	}
+	advance(250 * time.Millisecond)
+	if _, ok := limiter.Allow(1); !ok {
+		t.Fatal("refused after a token was refilled")
+	}
+	if _, ok := limiter.Allow(1); ok {
+		t.Fatal("refilled more than one token")
+	}
+
+	// Refills stop at the burst.
+	advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.Allow(1); !ok {
+			t.Fatalf("frame %d refused after a long pause", i+1)
+		}
+	}
+	if _, ok := limiter.Allow(1); ok {
+		t.Fatal("refilled beyond the burst")
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	limiter, advance := newTestRateLimiter(4, 1)
+	if retryAfter, ok := limiter.Allow(1); !ok || retryAfter != 0 {
+		t.Fatalf("got %v, %v for the first frame", retryAfter, ok)
+	}
+
+	retryAfter, ok := limiter.Allow(1)
+	if ok || retryAfter != 250*time.Millisecond {
+		t.Fatalf("got %v, %v, want 250ms, false", retryAfter, ok)
+	}
+
+	advance(100 * time.Millisecond)
+	retryAfter, ok = limiter.Allow(1)
+	if ok || retryAfter != 150*time.Millisecond {
+		t.Fatalf("got %v, %v, want 150ms, false", retryAfter, ok)
+	}
+
+	// Refused frames do not cost a token, so waiting as told is enough.
+	advance(retryAfter)
+	if _, ok := limiter.Allow(1); !ok {
+		t.Fatal("refused after waiting the advertised time")
+	}
+}
+
+func TestRateLimiterForgetsFullBuckets(t *testing.T) {
+	limiter, advance := newTestRateLimiter(10, 5)
+	limiter.Allow(1)
+	limiter.Allow(2)
+
+	advance(time.Second)
+	limiter.Allow(3)
+	if _, ok := limiter.buckets[1]; ok {
+		t.Fatal("refilled bucket kept")
+	}
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("got %d buckets, want 1", len(limiter.buckets))
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		limiter := NewRateLimiter(rate, 10)
+		if limiter != nil {
+			t.Fatalf("got a limiter for rate %v", rate)
+		}
+		for i := 0; i < 100; i++ {
+			if _, ok := limiter.Allow(1); !ok {
+				t.Fatal("disabled limiter refused a frame")
+			}
+		}
+	}
+
+	limiter, _ := newTestRateLimiter(1, 0)
+	if _, ok := limiter.Allow(1); !ok {
+		t.Fatal("burst below one refuses every frame")
+	}
+	if _, ok := limiter.Allow(1); ok {
+		t.Fatal("burst below one was not raised to exactly one")
+	}
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const registryShards = 32
+
+// ClientRegistry indexes the live connections by user and by connection id.
+// Both indexes are split over shards with their own locks, so lookups for
+// different users rarely contend.
+type ClientRegistry struct {
+	users  [registryShards]userShard
+	conns  [registryShards]connShard
+	lastId atomic.Uint64
+	count  atomic.Int64
+	limits ConnectionLimits
+}
+
+type userShard struct {
+	mu    sync.RWMutex
+	conns map[uint32][]*WebSocketConnInfo
+}
+
+type connShard struct {
+	mu    sync.RWMutex
+	conns map[uint64]*WebSocketConnInfo
+}
+
+func NewClientRegistry(limits ConnectionLimits) *ClientRegistry {
+	registry := &ClientRegistry{limits: limits}
+	for i := range registry.users {
+		registry.users[i].conns = make(map[uint32][]*WebSocketConnInfo)
+		registry.conns[i].conns = make(map[uint64]*WebSocketConnInfo)
+	}
+	return registry
+}
+
+func (registry *ClientRegistry) userShard(userId uint32) *userShard {
+	return &registry.users[userId%registryShards]
+}
+
+func (registry *ClientRegistry) connShard(connId uint64) *connShard {
+	return &registry.conns[connId%registryShards]
+}
+
+// Add registers the connection under a fresh connection id. Past a limit, the
+// connection is refused under ConnectionLimitReject. Otherwise the oldest
+// connections are unregistered to make room and returned for the caller to
+// close.
+func (registry *ClientRegistry) Add(connInfo *WebSocketConnInfo) ([]*WebSocketConnInfo, error) {
+	evict := registry.limits.Policy == ConnectionLimitEvictOldest
+	overLimit := func() bool {
+		return registry.limits.Total > 0 && registry.count.Load() > int64(registry.limits.Total)
+	}
+
+	// The slot is taken up front so concurrent Adds cannot overshoot.
+	registry.count.Add(1)
+	if !evict && overLimit() {
+		registry.count.Add(-1)
+		return nil, ErrConnectionLimit
+	}
+
+	connInfo.Id = registry.lastId.Add(1)
+
+	userId := uint32(connInfo.UserId)
+	users := registry.userShard(userId)
+	users.mu.Lock()
+	existing := users.conns[userId]
+	var stale []*WebSocketConnInfo
+	if connInfo.DeviceId != "" {
+		// A device reconnecting replaces its previous session.
+		kept := make([]*WebSocketConnInfo, 0, len(existing))
+		for _, c := range existing {
+			if c.sameDevice(connInfo) {
+				stale = append(stale, c)
+			} else {
+				kept = append(kept, c)
+			}
+		}
+		existing = kept
+	}
+	if registry.limits.PerUser > 0 && len(existing) >= registry.limits.PerUser {
+		if !evict {
+			users.mu.Unlock()
+			registry.count.Add(-1)
+			return nil, ErrUserConnectionLimit
+		}
+		// Connections are appended, so the oldest come first.
+		cut := len(existing) - registry.limits.PerUser + 1
+		stale, existing = append(stale, existing[:cut]...), existing[cut:]
+	}
+	// Copied on write, as readers of User keep iterating the old slice.
+	users.conns[userId] = append(existing[:len(existing):len(existing)], connInfo)
+	users.mu.Unlock()
+
+	conns := registry.connShard(connInfo.Id)
+	conns.mu.Lock()
+	conns.conns[connInfo.Id] = connInfo
+	conns.mu.Unlock()
+
+	// Whoever takes a connection out of the id index accounts for it, as Remove
+	// may be racing with us.
+	var evicted []*WebSocketConnInfo
+	for _, old := range stale {
+		conns := registry.connShard(old.Id)
+		conns.mu.Lock()
+		_, ok := conns.conns[old.Id]
+		delete(conns.conns, old.Id)
+		conns.mu.Unlock()
+		if ok {
+			registry.count.Add(-1)
+			evicted = append(evicted, old)
+		}
+	}
+
+	for evict && overLimit() {
+		oldest := registry.oldest()
+		if oldest == nil || oldest == connInfo {
+			// Only connections still being added are left.
+			break
+		}
+		if registry.Remove(oldest) {
+			evicted = append(evicted, oldest)
+		}
+	}
+	return evicted, nil
+}
+
+// sameDevice reports whether both are sessions of the same user on the same
+// declared device.
+func (connInfo *WebSocketConnInfo) sameDevice(other *WebSocketConnInfo) bool {
+	return connInfo.DeviceId != "" && connInfo.UserId == other.UserId && connInfo.DeviceId == other.DeviceId
+}
+
+// oldest returns the connection with the lowest id, which is the one added
+// first.
+func (registry *ClientRegistry) oldest() *WebSocketConnInfo {
+	var oldest *WebSocketConnInfo
+	for i := range registry.conns {
+		conns := &registry.conns[i]
+		conns.mu.RLock()
+		for _, connInfo := range conns.conns {
+			if oldest == nil || connInfo.Id < oldest.Id {
+				oldest = connInfo
+			}
+		}
+		conns.mu.RUnlock()
+	}
+	return oldest
+}
+
+// Remove unregisters the connection, reporting whether it was registered.
+func (registry *ClientRegistry) Remove(connInfo *WebSocketConnInfo) bool {
+	conns := registry.connShard(connInfo.Id)
+	conns.mu.Lock()
+	_, ok := conns.conns[connInfo.Id]
+	delete(conns.conns, connInfo.Id)
+	conns.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	userId := uint32(connInfo.UserId)
+	users := registry.userShard(userId)
+	users.mu.Lock()
+	remaining := make([]*WebSocketConnInfo, 0, len(users.conns[userId]))
+	for _, c := range users.conns[userId] {
+		if c != connInfo {
+			remaining = append(remaining, c)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(users.conns, userId)
+	} else {
+		users.conns[userId] = remaining
+	}
+	users.mu.Unlock()
+
+	registry.count.Add(-1)
+	return true
+}
+
+// User returns the connections of a user. The slice is never modified
+// afterwards, so it is safe to iterate without holding any lock.
+func (registry *ClientRegistry) User(userId uint32) []*WebSocketConnInfo {
+	users := registry.userShard(userId)
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+
+	return users.conns[userId]
+}
+
+// Conn looks a connection up by id.
+func (registry *ClientRegistry) Conn(connId uint64) (*WebSocketConnInfo, bool) {
+	conns := registry.connShard(connId)
+	conns.mu.RLock()
+	defer conns.mu.RUnlock()
+
+	connInfo, ok := conns.conns[connId]
+	return connInfo, ok
+}
+
+// All returns every connection, oldest first.
+func (registry *ClientRegistry) All() []*WebSocketConnInfo {
+	all := make([]*WebSocketConnInfo, 0, registry.Len())
+	for i := range registry.conns {
+		conns := &registry.conns[i]
+		conns.mu.RLock()
+		for _, connInfo := range conns.conns {
+			all = append(all, connInfo)
+		}
+		conns.mu.RUnlock()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Id < all[j].Id })
+	return all
+}
+
+// Users returns the ids of every connected user.
+func (registry *ClientRegistry) Users() []uint32 {
+	var userIds []uint32
+	for i := range registry.users {
+		users := &registry.users[i]
+		users.mu.RLock()
+		for userId := range users.conns {
+			userIds = append(userIds, userId)
+		}
+		users.mu.RUnlock()
+	}
+	return userIds
+}
+
+// Len returns the number of connections.
+func (registry *ClientRegistry) Len() int {
+	return int(registry.count.Load())
+}
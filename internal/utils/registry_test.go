@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"websocket-service/internal/model"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestConn(userId int, queueSize int) *WebSocketConnInfo {
+	return &WebSocketConnInfo{
+		UserId:  userId,
+		Codec:   model.JSONCodec,
+		send:    make(chan outboundMessage, queueSize),
+		closing: make(chan closeRequest, 1),
+	}
+}
+
+func newTestManager(queueSize int) *WebSocketManager {
+	manager := NewWebSocketManager(WebSocketManagerConfig{
+		SendQueueSize:      queueSize,
+		SlowConsumerPolicy: SlowConsumerDropOldest,
+	})
+	go manager.Run()
+	return manager
+}
+
+// drain consumes the connection's queue until stop is closed, standing in for
+// its writer.
+func drain(connInfo *WebSocketConnInfo, stop <-chan struct{}) int {
+	received := 0
+	for {
+		select {
+		case <-connInfo.send:
+			received++
+		case <-stop:
+			return received
+		}
+	}
+}
+
+func TestClientRegistryLookups(t *testing.T) {
+	registry := NewClientRegistry(ConnectionLimits{})
+	first := newTestConn(1, 1)
+	second := newTestConn(1, 1)
+	other := newTestConn(2, 1)
+	registry.Add(first)
+	registry.Add(second)
+	registry.Add(other)
+
+	if first.Id == second.Id || second.Id == other.Id {
+		t.Fatalf("connection ids are not unique: %d %d %d", first.Id, second.Id, other.Id)
+	}
+	if conns := registry.User(1); len(conns) != 2 {
+		t.Fatalf("user 1 has %d connections, want 2", len(conns))
+	}
+	if connInfo, ok := registry.Conn(other.Id); !ok || connInfo != other {
+		t.Fatalf("connection %d not found by id", other.Id)
+	}
+	if registry.Len() != 3 || len(registry.Users()) != 2 {
+		t.Fatalf("registry holds %d connections of %d users, want 3 of 2", registry.Len(), len(registry.Users()))
+	}
+
+	if !registry.Remove(first) || registry.Remove(first) {
+		t.Fatal("connection should be removed exactly once")
+	}
+	if conns := registry.User(1); len(conns) != 1 || conns[0] != second {
+		t.Fatalf("user 1 should only have its second connection left, got %v", conns)
+	}
+	if _, ok := registry.Conn(first.Id); ok {
+		t.Fatal("removed connection still found by id")
+	}
+
+	registry.Remove(second)
+	registry.Remove(other)
+	if registry.Len() != 0 || len(registry.Users()) != 0 {
+		t.Fatalf("registry not empty: %d connections, users %v", registry.Len(), registry.Users())
+	}
+}
+
+func TestClientRegistryRejectsPastLimits(t *testing.T) {
+	registry := NewClientRegistry(ConnectionLimits{PerUser: 2, Total: 3, Policy: ConnectionLimitReject})
+	for _, connInfo := range []*WebSocketConnInfo{newTestConn(1, 1), newTestConn(1, 1), newTestConn(2, 1)} {
+		if _, err := registry.Add(connInfo); err != nil {
+			t.Fatalf("connection within the limits refused: %v", err)
+		}
+	}
+
+	if _, err := registry.Add(newTestConn(1, 1)); err != ErrConnectionLimit {
+		t.Fatalf("got %v past the total limit, want %v", err, ErrConnectionLimit)
+	}
+	registry.Remove(registry.User(2)[0])
+	if _, err := registry.Add(newTestConn(1, 1)); err != ErrUserConnectionLimit {
+		t.Fatalf("got %v past the user limit, want %v", err, ErrUserConnectionLimit)
+	}
+	if registry.Len() != 2 || len(registry.User(1)) != 2 {
+		t.Fatalf("refused connections were counted: %d connections, %d for user 1", registry.Len(), len(registry.User(1)))
+	}
+}
+
+func TestClientRegistryEvictsOldest(t *testing.T) {
+	registry := NewClientRegistry(ConnectionLimits{PerUser: 2, Total: 3, Policy: ConnectionLimitEvictOldest})
+	first, second, other := newTestConn(1, 1), newTestConn(1, 1), newTestConn(2, 1)
+	registry.Add(first)
+	registry.Add(second)
+	registry.Add(other)
+
+	third := newTestConn(1, 1)
+	evicted, err := registry.Add(third)
+	if err != nil || len(evicted) != 1 || evicted[0] != first {
+		t.Fatalf("past the user limit got %v, %v, want the first connection evicted", evicted, err)
+	}
+	if conns := registry.User(1); len(conns) != 2 || conns[0] != second || conns[1] != third {
+		t.Fatalf("user 1 should keep its two newest connections, got %v", conns)
+	}
+	if registry.Remove(first) {
+		t.Fatal("evicted connection was still registered")
+	}
+
+	newcomer := newTestConn(3, 1)
+	evicted, err = registry.Add(newcomer)
+	if err != nil || len(evicted) != 1 || evicted[0] != second {
+		t.Fatalf("past the total limit got %v, %v, want the oldest connection evicted", evicted, err)
+	}
+	if registry.Len() != 3 {
+		t.Fatalf("registry holds %d connections, want 3", registry.Len())
+	}
+}
+
+func TestClientRegistryReplacesSessionOfSameDevice(t *testing.T) {
+	registry := NewClientRegistry(ConnectionLimits{PerUser: 2, Policy: ConnectionLimitReject})
+	phone, laptop := newTestConn(1, 1), newTestConn(1, 1)
+	phone.DeviceId, laptop.DeviceId = "phone", "laptop"
+	otherUser := newTestConn(2, 1)
+	otherUser.DeviceId = "phone"
+	registry.Add(phone)
+	registry.Add(laptop)
+	registry.Add(otherUser)
+
+	reconnected := newTestConn(1, 1)
+	reconnected.DeviceId = "phone"
+	evicted, err := registry.Add(reconnected)
+	if err != nil || len(evicted) != 1 || evicted[0] != phone {
+		t.Fatalf("reconnecting device got %v, %v, want its previous session replaced", evicted, err)
+	}
+	if conns := registry.User(1); len(conns) != 2 || conns[0] != laptop || conns[1] != reconnected {
+		t.Fatalf("user 1 should have its laptop and new phone session, got %v", conns)
+	}
+	if conns := registry.User(2); len(conns) != 1 {
+		t.Fatalf("another user's session on a device of the same name was touched: %v", conns)
+	}
+}
+
+func TestClientRegistryConcurrentAccess(t *testing.T) {
+	registry := NewClientRegistry(ConnectionLimits{})
+	const workers = 64
+	const rounds = 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				connInfo := newTestConn((w*rounds+i)%100, 1)
+				registry.Add(connInfo)
+				for _, c := range registry.User(uint32(connInfo.UserId)) {
+					_ = c.Id
+				}
+				if _, ok := registry.Conn(connInfo.Id); !ok {
+					t.Errorf("connection %d not found right after being added", connInfo.Id)
+				}
+				registry.Users()
+				if !registry.Remove(connInfo) {
+					t.Errorf("connection %d was not registered", connInfo.Id)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if registry.Len() != 0 || len(registry.Users()) != 0 {
+		t.Fatalf("registry not empty: %d connections, users %v", registry.Len(), registry.Users())
+	}
+}
+
+func TestWebSocketManagerDelivery(t *testing.T) {
+	manager := newTestManager(8)
+	first := newTestConn(1, 8)
+	second := newTestConn(1, 8)
+	manager.clients.Add(first)
+	manager.clients.Add(second)
+
+	manager.SendToUsers([]uint32{1}, model.FrameResponse{Type: model.FrameTypeNotification, Payload: model.NotificationPayload{Message: "all"}})
+	manager.SendToConn(second, model.FrameResponse{Type: model.FrameTypeNotification, Payload: model.NotificationPayload{Message: "one"}})
+	manager.BroadcastNotification("broadcast")
+
+	deadline := time.After(time.Second)
+	for len(first.send) < 2 || len(second.send) < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("got %d and %d frames, want 2 and 3", len(first.send), len(second.send))
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWebSocketManagerConcurrentConnectDisconnectFanOut(t *testing.T) {
+	manager := newTestManager(16)
+	const connections = 2000
+	const users = 200
+
+	var wg sync.WaitGroup
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			connInfo := newTestConn(i%users, 16)
+			stop := make(chan struct{})
+			drained := make(chan int)
+			go func() { drained <- drain(connInfo, stop) }()
+
+			manager.clients.Add(connInfo)
+			manager.SendToUsers([]uint32{uint32(i % users), uint32((i + 1) % users)}, model.FrameResponse{
+				Type:    model.FrameTypeNotification,
+				Payload: model.NotificationPayload{Message: "fan-out"},
+			})
+			manager.SendToConn(connInfo, model.FrameResponse{Type: model.FrameTypeAck, Payload: model.AckPayload{}})
+			if i%50 == 0 {
+				manager.BroadcastNotification("broadcast")
+			}
+			manager.clients.Remove(connInfo)
+
+			close(stop)
+			<-drained
+		}(i)
+	}
+	wg.Wait()
+
+	if manager.clients.Len() != 0 || len(manager.clients.Users()) != 0 {
+		t.Fatalf("registry not empty: %d connections, users %v", manager.clients.Len(), manager.clients.Users())
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"log"
+	"sort"
+	"websocket-service/internal/model"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// CloseDisconnected is sent to connections an administrator disconnects.
+const CloseDisconnected = websocket.ClosePolicyViolation
+
+const defaultDisconnectReason = "disconnected by an administrator"
+
+func (connInfo *WebSocketConnInfo) session() model.SessionResponse {
+	return model.SessionResponse{
+		SessionId:   connInfo.Id,
+		UserId:      connInfo.UserId,
+		DeviceId:    connInfo.DeviceId,
+		RemoteAddr:  connInfo.RemoteAddr,
+		Subprotocol: connInfo.Subprotocol,
+		ConnectedAt: connInfo.ConnectedAt,
+		BytesSent:   connInfo.bytesSent.Load(),
+		QueueDepth:  len(connInfo.send),
+	}
+}
+
+// Sessions lists the live connections grouped by user, in ascending user id.
+func (manager *WebSocketManager) Sessions() []model.UserSessionsResponse {
+	byUser := make(map[int][]model.SessionResponse)
+	for _, connInfo := range manager.clients.All() {
+		byUser[connInfo.UserId] = append(byUser[connInfo.UserId], connInfo.session())
+	}
+
+	users := make([]model.UserSessionsResponse, 0, len(byUser))
+	for userId, sessions := range byUser {
+		users = append(users, model.UserSessionsResponse{UserId: userId, Sessions: sessions})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserId < users[j].UserId })
+	return users
+}
+
+// UserSessions lists the live connections of a user, oldest first.
+func (manager *WebSocketManager) UserSessions(userId uint32) []model.SessionResponse {
+	conns := manager.clients.User(userId)
+	sessions := make([]model.SessionResponse, 0, len(conns))
+	for _, connInfo := range conns {
+		sessions = append(sessions, connInfo.session())
+	}
+	return sessions
+}
+
+// DisconnectUser closes every connection of the user, returning how many were
+// closed.
+func (manager *WebSocketManager) DisconnectUser(userId uint32, reason string) int {
+	disconnected := 0
+	for _, connInfo := range manager.clients.User(userId) {
+		if manager.disconnect(connInfo, reason) {
+			disconnected++
+		}
+	}
+	return disconnected
+}
+
+// DisconnectSession closes a single connection, reporting whether it was open.
+func (manager *WebSocketManager) DisconnectSession(sessionId uint64, reason string) bool {
+	connInfo, ok := manager.clients.Conn(sessionId)
+	if !ok {
+		return false
+	}
+	return manager.disconnect(connInfo, reason)
+}
+
+func (manager *WebSocketManager) disconnect(connInfo *WebSocketConnInfo, reason string) bool {
+	if reason == "" {
+		reason = defaultDisconnectReason
+	}
+	if !connInfo.requestClose(closeRequest{code: CloseDisconnected, reason: reason}) {
+		return false
+	}
+	log.Printf("Disconnecting connection %d of user %d: %s", connInfo.Id, connInfo.UserId, reason)
+	return true
+}
+
+// QueueStats reports how full the connections' send queues are.
+func (manager *WebSocketManager) QueueStats() model.QueueStatsResponse {
+	stats := model.QueueStatsResponse{
+		QueueCapacity: manager.config.SendQueueSize,
+		Backlogged:    []model.SessionResponse{},
+	}
+	for _, connInfo := range manager.clients.All() {
+		stats.Connections++
+		depth := len(connInfo.send)
+		if depth == 0 {
+			continue
+		}
+		stats.Queued += depth
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		if depth == cap(connInfo.send) {
+			stats.FullQueues++
+		}
+		stats.Backlogged = append(stats.Backlogged, connInfo.session())
+	}
+	sort.SliceStable(stats.Backlogged, func(i, j int) bool {
+		return stats.Backlogged[i].QueueDepth > stats.Backlogged[j].QueueDepth
+	})
+	return stats
+}
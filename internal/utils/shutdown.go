@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+	"websocket-service/internal/model"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// Draining reports whether the manager is shutting down and turning new
+// connections away.
+func (manager *WebSocketManager) Draining() bool {
+	return manager.draining.Load()
+}
+
+// ReconnectAfter is how many seconds clients should wait before reconnecting.
+func (manager *WebSocketManager) ReconnectAfter() int {
+	return int(math.Ceil(manager.config.ReconnectAfter.Seconds()))
+}
+
+// Shutdown turns new connections away and closes the open ones as going away,
+// after telling them when to reconnect and writing what is queued for them
+// until ctx is done. It returns once every connection is gone, or with an
+// error when ctx is done first, in which case CloseAll finishes the job.
+func (manager *WebSocketManager) Shutdown(ctx context.Context) error {
+	manager.draining.Store(true)
+
+	userIds := manager.clients.Users()
+	log.Printf("Closing %d connections of %d users", manager.clients.Len(), len(userIds))
+
+	flushUntil, _ := ctx.Deadline()
+	reconnectAfter := manager.ReconnectAfter()
+	job := &jobMessage{
+		UserIds: userIds,
+		Frame: model.FrameResponse{
+			Type:    model.FrameTypeShutdown,
+			Payload: model.ShutdownPayload{ReconnectAfter: reconnectAfter},
+		},
+		Close: &closeRequest{
+			code:       websocket.CloseGoingAway,
+			reason:     fmt.Sprintf("server shutting down, reconnect after %ds", reconnectAfter),
+			flushUntil: flushUntil,
+		},
+	}
+	select {
+	case manager.job <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return manager.awaitClosed(ctx)
+}
+
+// CloseAll closes the connections Shutdown could not drain in time. Their close
+// frames get until ctx is done, a deadline of their own rather than what is
+// left of the drain's; the connections still open then are dropped.
+func (manager *WebSocketManager) CloseAll(ctx context.Context) error {
+	manager.draining.Store(true)
+
+	reconnectAfter := manager.ReconnectAfter()
+	for _, connInfo := range manager.clients.All() {
+		connInfo.requestClose(closeRequest{
+			code:   websocket.CloseGoingAway,
+			reason: fmt.Sprintf("server shutting down, reconnect after %ds", reconnectAfter),
+		})
+	}
+
+	err := manager.awaitClosed(ctx)
+	if err != nil {
+		// Closing a hijacked connection is left to the server once the handler
+		// returns, so end the read instead.
+		for _, connInfo := range manager.clients.All() {
+			connInfo.Conn.SetReadDeadline(time.Now())
+		}
+	}
+	return err
+}
+
+func (manager *WebSocketManager) awaitClosed(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for manager.clients.Len() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d connections still open: %w", manager.clients.Len(), ctx.Err())
+		}
+	}
+	return nil
+}
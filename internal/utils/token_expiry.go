@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"log"
+	"time"
+	"websocket-service/internal/model"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// RenewToken (re)arms the warning and expiry timers of a connection for the given
+// claims. Tokens without an exp claim are never expired.
+func (manager *WebSocketManager) RenewToken(connInfo *WebSocketConnInfo, claims *Claims) {
+	connInfo.expiryMu.Lock()
+	defer connInfo.expiryMu.Unlock()
+
+	if connInfo.closed {
+		return
+	}
+
+	connInfo.stopExpiryTimers()
+	connInfo.Claims = claims
+	if claims.ExpiresAt == 0 {
+		return
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	connInfo.warnTimer = time.AfterFunc(time.Until(expiresAt.Add(-manager.config.TokenExpiryWarning)), func() {
+		connInfo.expiryMu.Lock()
+		defer connInfo.expiryMu.Unlock()
+
+		if connInfo.closed || connInfo.Claims != claims {
+			return
+		}
+		manager.SendToConn(connInfo, model.FrameResponse{
+			Type:    model.FrameTypeTokenExpiring,
+			Payload: model.TokenPayload{ExpiresAt: TokenExpiry(claims)},
+		})
+	})
+	connInfo.expireTimer = time.AfterFunc(time.Until(expiresAt), func() {
+		connInfo.expiryMu.Lock()
+		defer connInfo.expiryMu.Unlock()
+
+		if connInfo.closed || connInfo.Claims != claims {
+			return
+		}
+		log.Printf("Token expired for user %d at %s", connInfo.UserId, connInfo.Conn.RemoteAddr().String())
+		manager.CloseConn(connInfo, websocket.ClosePolicyViolation, "token expired")
+	})
+}
+
+// TokenExpiry formats the exp claim as RFC 3339, or "" when the token never expires.
+func TokenExpiry(claims *Claims) string {
+	if claims.ExpiresAt == 0 {
+		return ""
+	}
+	return time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339)
+}
+
+// stopTokenExpiry disarms the timers for good once the connection is gone.
+func (manager *WebSocketManager) stopTokenExpiry(connInfo *WebSocketConnInfo) {
+	connInfo.expiryMu.Lock()
+	defer connInfo.expiryMu.Unlock()
+
+	connInfo.closed = true
+	connInfo.stopExpiryTimers()
+}
+
+func (connInfo *WebSocketConnInfo) stopExpiryTimers() {
+	if connInfo.warnTimer != nil {
+		connInfo.warnTimer.Stop()
+	}
+	if connInfo.expireTimer != nil {
+		connInfo.expireTimer.Stop()
+	}
+}
@@ -1,9 +1,13 @@
 package utils
 
 import (
-	"encoding/json"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+	"websocket-service/internal/entity"
+	e "websocket-service/internal/exception"
 	"websocket-service/internal/model"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,84 +15,187 @@ import (
 )
 
 type WebSocketManager struct {
-	clients    map[uint32][]*websocket.Conn
-	job        chan *jobMessage
-	register   chan *WebSocketConnInfo
-	unregister chan *WebSocketConnInfo
-	mu         sync.Mutex
+	clients *ClientRegistry
+	job     chan *jobMessage
+	config  WebSocketManagerConfig
+
+	deflater    *deflater
+	compression compressionMetrics
+	draining    atomic.Bool
+}
+
+type WebSocketManagerConfig struct {
+	// TokenExpiryWarning is how long before the token expires the client is warned.
+	TokenExpiryWarning time.Duration
+	// Compression enables permessage-deflate for clients that offer it, at
+	// CompressionLevel for messages of at least CompressionThreshold bytes.
+	Compression          bool
+	CompressionLevel     int
+	CompressionThreshold int
+	// PingInterval is how often clients are pinged, 0 disabling pings. Clients
+	// that stay silent for PongWait, pongs included, are dropped.
+	PingInterval time.Duration
+	PongWait     time.Duration
+	// WriteTimeout bounds every write to a client.
+	WriteTimeout time.Duration
+	// SendQueueSize is how many frames may wait for a client before
+	// SlowConsumerPolicy kicks in.
+	SendQueueSize      int
+	SlowConsumerPolicy SlowConsumerPolicy
+	// ReconnectAfter is how long clients are asked to wait before reconnecting
+	// when the server shuts down.
+	ReconnectAfter time.Duration
+	Limits         ConnectionLimits
+	// ReadLimit caps the size of inbound messages in bytes, MaxInflightFrames
+	// how many of them may wait to be handled.
+	ReadLimit         int64
+	MaxInflightFrames int
 }
 
 type WebSocketConnInfo struct {
+	// Id is unique among the connections of this instance.
+	Id     uint64
 	UserId int
-	Conn   *websocket.Conn
+	// DeviceId is declared by the client at handshake. A user holds a single
+	// session per device; connections without one are all distinct devices.
+	DeviceId    string
+	ConnectedAt time.Time
+	// RemoteAddr and Subprotocol are kept apart from Conn, which is recycled
+	// once the connection is closed.
+	RemoteAddr  string
+	Subprotocol string
+	Conn        *websocket.Conn
+	Claims      *Claims
+	// Codec serializes frames in the format negotiated at handshake.
+	Codec model.Codec
+
+	compressed bool
+	// send queues the frames the connection's writer has yet to write.
+	send           chan outboundMessage
+	closing        chan closeRequest
+	closeRequested atomic.Bool
+	bytesSent      atomic.Uint64
+
+	expiryMu    sync.Mutex
+	warnTimer   *time.Timer
+	expireTimer *time.Timer
+	closed      bool
+}
+
+// Application close codes, mirroring the matching HTTP statuses.
+const (
+	CloseUnauthorized = 4401
+	CloseForbidden    = 4403
+	CloseTimeout      = 4408
+	// CloseTooManyConnections is sent to connections refused or evicted over a
+	// connection limit.
+	CloseTooManyConnections = 4429
+	// CloseSessionReplaced is sent to a session when the same device connects
+	// again.
+	CloseSessionReplaced = 4409
+)
+
+const closeWriteTimeout = time.Second
+
+// MaxCloseReasonLength is how many bytes of reason fit in a close frame.
+const MaxCloseReasonLength = 123
+
+// truncateCloseReason cuts reason to fit a close frame, without splitting a
+// character, as a frame too long is not sent at all.
+func truncateCloseReason(reason string) string {
+	if len(reason) <= MaxCloseReasonLength {
+		return reason
+	}
+	end := MaxCloseReasonLength
+	for end > 0 && !utf8.RuneStart(reason[end]) {
+		end--
+	}
+	return reason[:end]
 }
 
 type jobMessage struct {
 	UserIds []uint32
-	Message []byte
+	// Conn restricts delivery to a single connection of the (only) user in UserIds.
+	Conn *WebSocketConnInfo
+	// Devices restricts delivery to those devices of the users.
+	Devices []string
+	// Origin, the connection the frame stems from, is left out.
+	Origin *WebSocketConnInfo
+	Frame  model.FrameResponse
+	// Close, when set, closes the connections once the frame is written.
+	Close *closeRequest
 }
 
-func NewWebSocketManager() *WebSocketManager {
+func NewWebSocketManager(config WebSocketManagerConfig) *WebSocketManager {
 	return &WebSocketManager{
-		clients:    make(map[uint32][]*websocket.Conn),
-		job:        make(chan *jobMessage),
-		register:   make(chan *WebSocketConnInfo),
-		unregister: make(chan *WebSocketConnInfo),
+		clients:  NewClientRegistry(config.Limits),
+		job:      make(chan *jobMessage),
+		config:   config,
+		deflater: newDeflater(config.CompressionLevel),
 	}
 }
 
+// Run delivers the queued jobs. It is the only goroutine feeding the
+// connections' send queues, which enqueue relies on.
 func (manager *WebSocketManager) Run() {
-	for {
-		select {
-		case connInfo := <-manager.register:
-			manager.addClient(connInfo.UserId, connInfo.Conn)
-		case connInfo := <-manager.unregister:
-			manager.removeClient(uint32(connInfo.UserId), connInfo.Conn)
-		case jobMsg := <-manager.job:
-			manager.jobMessage(jobMsg)
-		}
+	for jobMsg := range manager.job {
+		manager.jobMessage(jobMsg)
 	}
 }
 
-func (manager *WebSocketManager) addClient(userId int, conn *websocket.Conn) {
-	manager.mu.Lock()
-	defer manager.mu.Unlock()
-
-	manager.clients[uint32(userId)] = append(manager.clients[uint32(userId)], conn)
-	log.Printf("New connection for user %d: %s", userId, conn.RemoteAddr().String())
-}
-
-func (manager *WebSocketManager) removeClient(userId uint32, conn *websocket.Conn) {
-	manager.mu.Lock()
-	defer manager.mu.Unlock()
+func (manager *WebSocketManager) addClient(connInfo *WebSocketConnInfo) error {
+	evicted, err := manager.clients.Add(connInfo)
+	if err != nil {
+		return err
+	}
+	log.Printf("New connection %d for user %d: %s", connInfo.Id, connInfo.UserId, connInfo.Conn.RemoteAddr().String())
 
-	if conns, ok := manager.clients[userId]; ok {
-		for i, c := range conns {
-			if c == conn {
-				manager.clients[userId] = append(conns[:i], conns[i+1:]...)
-				conn.Close()
-				log.Printf("Connection closed for user %d", userId)
-				break
-			}
+	for _, old := range evicted {
+		if old.sameDevice(connInfo) {
+			log.Printf("Replacing connection %d of user %d on device %s", old.Id, old.UserId, old.DeviceId)
+			old.requestClose(closeRequest{code: CloseSessionReplaced, reason: "replaced by a new session on this device"})
+			continue
 		}
+		log.Printf("Evicting connection %d of user %d over the connection limit", old.Id, old.UserId)
+		old.requestClose(closeRequest{code: CloseTooManyConnections, reason: "replaced by a newer connection"})
+	}
+	return nil
+}
 
-		if len(manager.clients[userId]) == 0 {
-			delete(manager.clients, userId)
-		}
+func (manager *WebSocketManager) removeClient(connInfo *WebSocketConnInfo) {
+	if manager.clients.Remove(connInfo) {
+		connInfo.Conn.Close()
+		log.Printf("Connection %d closed for user %d", connInfo.Id, connInfo.UserId)
 	}
 }
 
 func (manager *WebSocketManager) jobMessage(jobMsg *jobMessage) {
-	manager.mu.Lock()
-	defer manager.mu.Unlock()
+	log.Printf("jobing %s frame to %d users", jobMsg.Frame.Type, len(jobMsg.UserIds))
 
-	log.Printf("jobing message to %d users: %s", len(jobMsg.UserIds), string(jobMsg.Message))
+	// Encode once per codec rather than once per connection.
+	encoded := make(map[model.Codec][]byte)
+	compressedSizes := make(map[model.Codec]int)
 	for _, userId := range jobMsg.UserIds {
-		if conns, ok := manager.clients[userId]; ok {
-			for _, conn := range conns {
-				if err := conn.WriteMessage(websocket.TextMessage, jobMsg.Message); err != nil {
-					log.Printf("Failed to send message to user %d at %s: %v", userId, conn.RemoteAddr().String(), err)
-					manager.removeClient(userId, conn)
+		if conns := manager.clients.User(userId); len(conns) > 0 {
+			for _, connInfo := range conns {
+				if !jobMsg.targets(connInfo) {
+					continue
+				}
+
+				data, ok := encoded[connInfo.Codec]
+				if !ok {
+					var err error
+					data, err = connInfo.Codec.Encode(jobMsg.Frame)
+					if err != nil {
+						log.Printf("Failed to marshal %s frame: %v", jobMsg.Frame.Type, err)
+					}
+					encoded[connInfo.Codec] = data
+				}
+				if data != nil {
+					manager.enqueue(connInfo, manager.outboundMessage(connInfo, jobMsg.Frame.Type, data, compressedSizes))
+				}
+				if jobMsg.Close != nil {
+					connInfo.requestClose(*jobMsg.Close)
 				}
 			}
 		} else {
@@ -97,6 +204,47 @@ func (manager *WebSocketManager) jobMessage(jobMsg *jobMessage) {
 	}
 }
 
+func (jobMsg *jobMessage) targets(connInfo *WebSocketConnInfo) bool {
+	if jobMsg.Conn != nil && jobMsg.Conn != connInfo {
+		return false
+	}
+	if jobMsg.Origin == connInfo {
+		return false
+	}
+	if jobMsg.Devices == nil {
+		return true
+	}
+	for _, deviceId := range jobMsg.Devices {
+		if deviceId == connInfo.DeviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundMessage wraps the encoded frame for the connection. The compressed
+// size of sampled messages is measured at most once per codec.
+func (manager *WebSocketManager) outboundMessage(connInfo *WebSocketConnInfo, frameType string, data []byte, compressedSizes map[model.Codec]int) outboundMessage {
+	message := outboundMessage{
+		frameType:   frameType,
+		messageType: websocket.TextMessage,
+		data:        data,
+		compress:    connInfo.compressed && len(data) >= manager.config.CompressionThreshold,
+	}
+	if connInfo.Codec.Binary() {
+		message.messageType = websocket.BinaryMessage
+	}
+	if message.compress && manager.compression.sample() {
+		size, ok := compressedSizes[connInfo.Codec]
+		if !ok {
+			size = manager.deflater.compressedSize(data)
+			compressedSizes[connInfo.Codec] = size
+		}
+		message.compressedSize = size
+	}
+	return message
+}
+
 // public functions areas
 
 func (manager *WebSocketManager) HandleWebSocket(c *fiber.Ctx) error {
@@ -107,88 +255,229 @@ func (manager *WebSocketManager) HandleWebSocket(c *fiber.Ctx) error {
 	return fiber.ErrUpgradeRequired
 }
 
-func (manager *WebSocketManager) WebSocketEndpoint(c *websocket.Conn, userId int, callback func(userId int, request model.MessageRequest) ([]uint32, error)) {
+// CloseWithReason sends a close frame with the given code and reason and closes the socket.
+func CloseWithReason(c *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, truncateCloseReason(reason))
+	if err := c.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout)); err != nil {
+		log.Printf("Failed to send close frame to %s: %v", c.RemoteAddr().String(), err)
+	}
+	c.Close()
+}
+
+// WebSocketEndpoint registers the connection and feeds every frame it reads to
+// callback until the socket is closed.
+func (manager *WebSocketManager) WebSocketEndpoint(c *websocket.Conn, userId int, deviceId string, claims *Claims, callback func(connInfo *WebSocketConnInfo, frame model.FrameRequest)) {
 	connInfo := &WebSocketConnInfo{
-		UserId: userId,
-		Conn:   c,
+		UserId:      userId,
+		DeviceId:    deviceId,
+		ConnectedAt: time.Now(),
+		RemoteAddr:  c.RemoteAddr().String(),
+		Subprotocol: c.Subprotocol(),
+		Conn:        c,
+		Codec:       model.CodecFor(c.Subprotocol()),
+		send:        make(chan outboundMessage, manager.config.SendQueueSize),
+		closing:     make(chan closeRequest, 1),
 	}
 
-	manager.register <- connInfo
+	if manager.config.Compression && negotiatedCompression(c) {
+		connInfo.compressed = true
+		if err := c.SetCompressionLevel(manager.config.CompressionLevel); err != nil {
+			log.Printf("Failed to set compression level for user %d: %v", userId, err)
+		}
+	}
+
+	if err := manager.addClient(connInfo); err != nil {
+		log.Printf("Refusing connection for user %d at %s: %v", userId, c.RemoteAddr().String(), err)
+		CloseWithReason(c, CloseTooManyConnections, err.Error())
+		return
+	}
+	manager.RenewToken(connInfo, claims)
+
+	manager.extendReadDeadline(c)
+	c.SetPongHandler(func(string) error {
+		manager.extendReadDeadline(c)
+		return nil
+	})
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		manager.writePump(connInfo, done)
+	}()
+
+	inbound := make(chan model.FrameRequest, manager.config.MaxInflightFrames)
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		manager.process(connInfo, inbound, callback)
+	}()
 
 	defer func() {
-		manager.unregister <- connInfo
+		close(inbound)
+		<-processed
+		manager.stopTokenExpiry(connInfo)
+		// The socket is released once we return, so the writer has to stop first.
+		close(done)
+		<-stopped
+		manager.removeClient(connInfo)
 	}()
 
 	for {
-		_, message, err := c.ReadMessage()
-
-		var request model.MessageRequest
-		err = json.Unmarshal(message, &request)
+		message, err := manager.readMessage(c)
 		if err != nil {
-			log.Printf("request format invalid %d: %v", userId, err)
-			continue
+			if connInfo.closeRequested.Load() {
+				// The writer has sent the close frame already.
+				log.Printf("Connection closed for user %d: %v", userId, err)
+			} else if isTimeout(err) {
+				log.Printf("Connection timed out for user %d at %s", userId, c.RemoteAddr().String())
+				CloseWithReason(c, CloseTimeout, "ping timeout")
+			} else if err == errMessageTooBig {
+				log.Printf("Message too big from user %d at %s", userId, c.RemoteAddr().String())
+				CloseWithReason(c, websocket.CloseMessageTooBig, "message too big")
+			} else {
+				log.Printf("Read failed for user %d: %v", userId, err)
+			}
+			break
 		}
+		manager.extendReadDeadline(c)
 
-		userIds, err := callback(userId, request)
+		frame, err := connInfo.Codec.Decode(message)
 		if err != nil {
-			log.Printf("Failed to read message: %v", err)
+			log.Printf("request format invalid %d: %v", userId, err)
+			manager.SendToConn(connInfo, model.NewErrorFrame(frame.RequestId, e.Validation(err)))
 			continue
 		}
 
-		log.Printf("Received message from user %d: %s", userId, message)
-
-		manager.JobMessageChat(userIds, request.Message)
-		manager.JobMessageNotification(userIds, request.Message)
+		inbound <- frame
+		// Waiting for room in the queue may have eaten into the deadline.
+		manager.extendReadDeadline(c)
 	}
 }
 
 func (manager *WebSocketManager) BroadcastNotification(message string) {
-	var userIds []uint32
-	for userId := range manager.clients {
-		userIds = append(userIds, userId)
-	}
-
-	manager.JobMessageNotification(userIds, message)
+	manager.JobMessageNotification(manager.clients.Users(), message, nil)
 }
 
-func (manager *WebSocketManager) JobMessageChat(userIds []uint32, message string) {
-	response := model.MessageResponse{
-		MessageType: model.MessageTypeChat,
-		Message:     message,
+// JobMessageChat delivers the message to the users' connections except origin,
+// the one it was sent from, unless origin is nil.
+func (manager *WebSocketManager) JobMessageChat(userIds []uint32, message entity.Message, origin *WebSocketConnInfo) {
+	manager.job <- &jobMessage{
+		UserIds: userIds,
+		Origin:  origin,
+		Frame: model.FrameResponse{
+			Type:    model.FrameTypeChatMessage,
+			Payload: NewChatMessagePayload(message),
+		},
 	}
-	responseByte, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Failed to marshal response: %v", err)
-		return
+}
+
+func NewChatMessagePayload(message entity.Message) model.ChatMessagePayload {
+	return model.ChatMessagePayload{
+		MessageId:      message.ID,
+		ConversationId: message.ConversationID,
+		SenderId:       message.SenderID,
+		ParentId:       message.ParentID,
+		Message:        message.Content,
+		SentAt:         message.CreatedAt,
 	}
+}
+
+func (manager *WebSocketManager) JobMessageUpdated(userIds []uint32, message entity.Message, editedBy int) {
+	manager.SendToUsers(userIds, model.FrameResponse{
+		Type: model.FrameTypeMessageUpdated,
+		Payload: model.MessageUpdatedPayload{
+			MessageId:      message.ID,
+			ConversationId: message.ConversationID,
+			SenderId:       message.SenderID,
+			Message:        message.Content,
+			EditedBy:       editedBy,
+			EditedAt:       message.EditedAt,
+		},
+	})
+}
+
+func (manager *WebSocketManager) JobMessageDeleted(userIds []uint32, message entity.Message, deletedBy int) {
+	manager.SendToUsers(userIds, model.FrameResponse{
+		Type: model.FrameTypeMessageDeleted,
+		Payload: model.MessageDeletedPayload{
+			MessageId:      message.ID,
+			ConversationId: message.ConversationID,
+			SenderId:       message.SenderID,
+			DeletedBy:      deletedBy,
+			DeletedAt:      message.DeletedAt,
+		},
+	})
+}
 
+func (manager *WebSocketManager) JobReaction(userIds []uint32, reaction model.ReactionPayload) {
+	manager.SendToUsers(userIds, model.FrameResponse{
+		Type:    model.FrameTypeReaction,
+		Payload: reaction,
+	})
+}
+
+// JobMessageNotification notifies the users' connections except origin,
+// unless origin is nil.
+func (manager *WebSocketManager) JobMessageNotification(userIds []uint32, message string, origin *WebSocketConnInfo) {
 	manager.job <- &jobMessage{
 		UserIds: userIds,
-		Message: responseByte,
+		Origin:  origin,
+		Frame: model.FrameResponse{
+			Type:    model.FrameTypeNotification,
+			Payload: model.NotificationPayload{Message: message},
+		},
 	}
 }
 
-func (manager *WebSocketManager) JobMessageNotification(userIds []uint32, message string) {
-	response := model.MessageResponse{
-		MessageType: model.MessageTypeNotification,
-		Message:     message,
-	}
-	responseByte, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Failed to marshal response: %v", err)
-		return
-	}
+// JobDeviceNotification notifies the user on the given device only.
+func (manager *WebSocketManager) JobDeviceNotification(userId uint32, deviceId string, message string) {
+	manager.SendToDevices(userId, []string{deviceId}, model.FrameResponse{
+		Type:    model.FrameTypeNotification,
+		Payload: model.NotificationPayload{Message: message},
+	})
+}
+
+func (manager *WebSocketManager) JobTyping(userIds []uint32, conversationId int, userId int, typing bool) {
+	manager.SendToUsers(userIds, model.FrameResponse{
+		Type: model.FrameTypeTyping,
+		Payload: model.TypingPayload{
+			ConversationId: conversationId,
+			UserId:         userId,
+			Typing:         typing,
+		},
+	})
+}
+
+func (manager *WebSocketManager) JobReceipt(senderId uint32, receipt model.ReceiptPayload) {
+	manager.SendToUsers([]uint32{senderId}, model.FrameResponse{
+		Type:    model.FrameTypeReceipt,
+		Payload: receipt,
+	})
+}
 
+// SendToUsers delivers the frame to every connection of the given users.
+func (manager *WebSocketManager) SendToUsers(userIds []uint32, frame model.FrameResponse) {
 	manager.job <- &jobMessage{
 		UserIds: userIds,
-		Message: responseByte,
+		Frame:   frame,
 	}
+}
 
+// SendToDevices delivers the frame to the user's sessions on those devices.
+func (manager *WebSocketManager) SendToDevices(userId uint32, deviceIds []string, frame model.FrameResponse) {
+	manager.job <- &jobMessage{
+		UserIds: []uint32{userId},
+		Devices: deviceIds,
+		Frame:   frame,
+	}
 }
 
-func (manager *WebSocketManager) jobMessageToUsers(userIds []uint32, message []byte) {
+// SendToConn delivers the frame to a single connection, typically as a reply.
+func (manager *WebSocketManager) SendToConn(connInfo *WebSocketConnInfo, frame model.FrameResponse) {
 	manager.job <- &jobMessage{
-		UserIds: userIds,
-		Message: message,
+		UserIds: []uint32{uint32(connInfo.UserId)},
+		Conn:    connInfo,
+		Frame:   frame,
 	}
 }
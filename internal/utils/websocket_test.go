@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateCloseReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{"short", "maintenance", "maintenance"},
+		{"exactly the limit", strings.Repeat("a", 123), strings.Repeat("a", 123)},
+		{"too long", strings.Repeat("a", 200), strings.Repeat("a", 123)},
+		{"multibyte at the limit", strings.Repeat("é", 61) + "a", strings.Repeat("é", 61) + "a"},
+		// 41 three-byte characters are 123 bytes, 42 would be 126.
+		{"multibyte across the limit", strings.Repeat("€", 42), strings.Repeat("€", 41)},
+		{"four-byte characters", strings.Repeat("👋", 40), strings.Repeat("👋", 30)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateCloseReason(test.reason)
+			if got != test.want {
+				t.Fatalf("got %q (%d bytes), want %q", got, len(got), test.want)
+			}
+			if len(got) > MaxCloseReasonLength || !utf8.ValidString(got) {
+				t.Fatalf("%q does not fit a close frame", got)
+			}
+		})
+	}
+}
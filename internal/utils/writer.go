@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// SlowConsumerPolicy decides what happens to a frame for a client whose send
+// queue is full.
+type SlowConsumerPolicy string
+
+const (
+	SlowConsumerDropOldest SlowConsumerPolicy = "drop_oldest"
+	SlowConsumerDropNewest SlowConsumerPolicy = "drop_newest"
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+func ParseSlowConsumerPolicy(value string) (SlowConsumerPolicy, error) {
+	switch policy := SlowConsumerPolicy(value); policy {
+	case SlowConsumerDropOldest, SlowConsumerDropNewest, SlowConsumerDisconnect:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown slow consumer policy %q", value)
+}
+
+type outboundMessage struct {
+	frameType   string
+	messageType int
+	data        []byte
+	// compress asks for permessage-deflate; compressedSize is only for metrics,
+	// and zero unless the message was sampled.
+	compress       bool
+	compressedSize int
+}
+
+type closeRequest struct {
+	code   int
+	reason string
+	// flushUntil lets the writer write what is still queued until then before
+	// closing.
+	flushUntil time.Time
+}
+
+// requestClose has the connection's writer send a close frame and close the
+// socket. Only the first request counts, which is reported.
+func (connInfo *WebSocketConnInfo) requestClose(request closeRequest) bool {
+	if !connInfo.closeRequested.CompareAndSwap(false, true) {
+		return false
+	}
+	connInfo.closing <- request
+	return true
+}
+
+// CloseConn has the connection's writer send a close frame with code and
+// reason and close the socket, dropping what is still queued. Only the first
+// close of a connection counts, which is reported.
+func (manager *WebSocketManager) CloseConn(connInfo *WebSocketConnInfo, code int, reason string) bool {
+	return connInfo.requestClose(closeRequest{code: code, reason: reason})
+}
+
+// enqueue hands the message to the connection's writer without ever blocking,
+// applying the slow consumer policy when its queue is full. Only Run enqueues,
+// so once a slot is freed it stays free. Nothing is queued once the connection
+// is closing.
+func (manager *WebSocketManager) enqueue(connInfo *WebSocketConnInfo, message outboundMessage) {
+	if connInfo.closeRequested.Load() {
+		return
+	}
+
+	select {
+	case connInfo.send <- message:
+		return
+	default:
+	}
+
+	switch manager.config.SlowConsumerPolicy {
+	case SlowConsumerDropNewest:
+		log.Printf("Send queue full for user %d, dropping %s frame", connInfo.UserId, message.frameType)
+	case SlowConsumerDropOldest:
+		for {
+			select {
+			case dropped := <-connInfo.send:
+				log.Printf("Send queue full for user %d, dropping %s frame", connInfo.UserId, dropped.frameType)
+			default:
+			}
+
+			select {
+			case connInfo.send <- message:
+				return
+			default:
+			}
+		}
+	default:
+		if connInfo.requestClose(closeRequest{code: websocket.ClosePolicyViolation, reason: "slow consumer"}) {
+			log.Printf("Send queue full for user %d, disconnecting", connInfo.UserId)
+		}
+	}
+}
+
+// writePump is the only writer of data frames and pings to the connection. It
+// runs until done is closed or the socket fails, closing the socket in the
+// latter case so the read loop ends too.
+func (manager *WebSocketManager) writePump(connInfo *WebSocketConnInfo, done <-chan struct{}) {
+	var ping <-chan time.Time
+	if manager.config.PingInterval > 0 {
+		ticker := time.NewTicker(manager.config.PingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case request := <-connInfo.closing:
+			manager.flush(connInfo, request.flushUntil)
+			CloseWithReason(connInfo.Conn, request.code, request.reason)
+			return
+		case message := <-connInfo.send:
+			if err := manager.write(connInfo, message, manager.writeDeadline()); err != nil {
+				log.Printf("Failed to send message to user %d at %s: %v", connInfo.UserId, connInfo.Conn.RemoteAddr().String(), err)
+				connInfo.Conn.Close()
+				return
+			}
+		case <-ping:
+			if err := manager.ping(connInfo.Conn); err != nil {
+				log.Printf("Ping failed for user %d at %s: %v", connInfo.UserId, connInfo.Conn.RemoteAddr().String(), err)
+				connInfo.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// flush writes what is still queued, giving up at the deadline.
+func (manager *WebSocketManager) flush(connInfo *WebSocketConnInfo, until time.Time) {
+	for time.Now().Before(until) {
+		select {
+		case message := <-connInfo.send:
+			deadline := manager.writeDeadline()
+			if deadline.IsZero() || until.Before(deadline) {
+				deadline = until
+			}
+			if err := manager.write(connInfo, message, deadline); err != nil {
+				log.Printf("Failed to flush message to user %d at %s: %v", connInfo.UserId, connInfo.Conn.RemoteAddr().String(), err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// write writes the message, failing if it is not done by the deadline unless
+// the deadline is zero.
+func (manager *WebSocketManager) write(connInfo *WebSocketConnInfo, message outboundMessage, deadline time.Time) error {
+	connInfo.Conn.EnableWriteCompression(message.compress)
+	connInfo.Conn.SetWriteDeadline(deadline)
+	if err := connInfo.Conn.WriteMessage(message.messageType, message.data); err != nil {
+		return err
+	}
+
+	connInfo.bytesSent.Add(uint64(len(message.data)))
+	if message.compress {
+		manager.compression.record(len(message.data), message.compressedSize)
+	}
+	return nil
+}